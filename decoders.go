@@ -0,0 +1,208 @@
+package rest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// UnmarshalFunc unmarshals a request body of a media type into v.
+type UnmarshalFunc func(data []byte, v interface{}) error
+
+var (
+	decoders = map[string]UnmarshalFunc{
+		"application/json": json.Unmarshal,
+		"application/xml":  xml.Unmarshal,
+		"text/xml":         xml.Unmarshal,
+	}
+	decodersMutex sync.RWMutex
+)
+
+/*
+RegisterDecoder registers unmarshal as decoder for request bodies
+of the media type mediaType, like "application/yaml".
+An already registered decoder for mediaType will be replaced.
+
+Request bodies of POST, PUT and PATCH handlers with a struct pointer
+argument will be unmarshalled with the decoder registered
+for the media type of the Content-Type header.
+Media types with a structured syntax suffix like application/vnd.api+json
+or application/problem+xml that have no decoder registered
+will be unmarshalled with the decoder of the suffix,
+like application/json or application/xml.
+
+Example:
+
+	rest.RegisterDecoder("application/yaml", yaml.Unmarshal)
+*/
+func RegisterDecoder(mediaType string, unmarshal UnmarshalFunc) {
+	decodersMutex.Lock()
+	defer decodersMutex.Unlock()
+	decoders[strings.ToLower(mediaType)] = unmarshal
+}
+
+// lookupDecoder returns the decoder registered for mediaType
+// or for its structured syntax suffix.
+func lookupDecoder(mediaType string) (UnmarshalFunc, bool) {
+	decodersMutex.RLock()
+	defer decodersMutex.RUnlock()
+	if unmarshal, ok := decoders[mediaType]; ok {
+		return unmarshal, true
+	}
+	if plus := strings.LastIndexByte(mediaType, '+'); plus != -1 && strings.IndexByte(mediaType, '/') < plus {
+		unmarshal, ok := decoders["application/"+mediaType[plus+1:]]
+		return unmarshal, ok
+	}
+	return nil, false
+}
+
+// isJSONMediaType returns if mediaType is application/json
+// or has the structured syntax suffix +json.
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// parseContentType returns the lower case media type and
+// the parameters of the Content-Type header of request.
+// The media type is empty if the request has no Content-Type.
+func parseContentType(request *http.Request) (mediaType string, params map[string]string, err error) {
+	ct := request.Header.Get("Content-Type")
+	if ct == "" {
+		return "", nil, nil
+	}
+	mediaType, params, err = mime.ParseMediaType(ct)
+	if err != nil {
+		return "", nil, BadRequest("invalid Content-Type %q: %s", ct, err)
+	}
+	return mediaType, params, nil
+}
+
+// CharsetReader if not nil is used to convert request bodies
+// with charsets other than UTF-8, US-ASCII, ISO-8859-1 and UTF-16 to UTF-8.
+// It returns a reader for input that converts from charset to UTF-8.
+// The signature matches charset.NewReaderLabel
+// of the package golang.org/x/net/html/charset.
+// Requests with other charsets get a 415 unsupported media type response.
+var CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+
+// toUTF8 converts data from charset to UTF-8.
+func toUTF8(data []byte, charset string) ([]byte, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return data, nil
+	case "iso-8859-1", "iso8859-1", "latin1", "l1":
+		converted := make([]byte, 0, len(data))
+		for _, b := range data {
+			converted = utf8.AppendRune(converted, rune(b))
+		}
+		return converted, nil
+	case "utf-16", "utf-16be", "utf-16le":
+		return utf16ToUTF8(data, strings.ToLower(charset))
+	}
+	if CharsetReader == nil {
+		return nil, unsupportedMediaType("unsupported charset %q", charset)
+	}
+	reader, err := CharsetReader(charset, strings.NewReader(string(data)))
+	if err != nil {
+		return nil, unsupportedMediaType("unsupported charset %q: %s", charset, err)
+	}
+	return ioutil.ReadAll(reader)
+}
+
+// utf16ToUTF8 converts UTF-16 data to UTF-8.
+// A byte order mark overrides the byte order of charset,
+// without byte order mark utf-16 is big endian.
+func utf16ToUTF8(data []byte, charset string) ([]byte, error) {
+	if len(data)%2 != 0 {
+		return nil, BadRequest("invalid %s body with odd length", charset)
+	}
+	bigEndian := charset != "utf-16le"
+	if len(data) >= 2 {
+		switch {
+		case data[0] == 0xFE && data[1] == 0xFF:
+			bigEndian, data = true, data[2:]
+		case data[0] == 0xFF && data[1] == 0xFE:
+			bigEndian, data = false, data[2:]
+		}
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	return []byte(string(utf16.Decode(units))), nil
+}
+
+// formToUTF8 returns the parsed form of request like request.Form,
+// but with the keys and values of the body that were
+// percent-decoded as bytes of charset converted to UTF-8.
+// The URL query values are always UTF-8 and not converted.
+func formToUTF8(request *http.Request, charset string) (url.Values, error) {
+	converted, err := valuesToUTF8(request.PostForm, charset)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range request.URL.Query() {
+		converted[key] = append(converted[key], values...)
+	}
+	return converted, nil
+}
+
+// valuesToUTF8 converts the keys and values of form
+// that were percent-decoded as bytes of charset to UTF-8.
+func valuesToUTF8(form url.Values, charset string) (url.Values, error) {
+	converted := make(url.Values, len(form))
+	convert := func(s string) (string, error) {
+		data, err := toUTF8([]byte(s), charset)
+		return string(data), err
+	}
+	for key, values := range form {
+		key, err := convert(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			value, err := convert(value)
+			if err != nil {
+				return nil, err
+			}
+			converted[key] = append(converted[key], value)
+		}
+	}
+	return converted, nil
+}
+
+// readBody reads the body of request and converts it
+// from the charset of the Content-Type to UTF-8.
+func readBody(request *http.Request, charset string) ([]byte, error) {
+	defer request.Body.Close()
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return nil, badRequestError(err)
+	}
+	return toUTF8(body, charset)
+}
+
+// decodeBody reads the body of request and unmarshals it into v.
+func decodeBody(request *http.Request, unmarshal UnmarshalFunc, v interface{}) error {
+	defer request.Body.Close()
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return badRequestError(err)
+	}
+	if err = unmarshal(body, v); err != nil {
+		return decodeError(err, body)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package rest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestContentTypeDecoding(t *testing.T) {
+	RegisterDecoder("application/x-test", func(data []byte, v interface{}) error {
+		v.(*Struct).String = strings.ToUpper(string(data))
+		return nil
+	})
+	defer func() {
+		decodersMutex.Lock()
+		delete(decoders, "application/x-test")
+		decodersMutex.Unlock()
+	}()
+
+	server := NewServer()
+	server.HandlePOST("/struct", func(in *Struct) string { return in.String })
+	server.HandlePOST("/string", func(in string) string { return in })
+	server.HandlePOST("/values", func(in url.Values) string { return in.Get("name") })
+
+	for _, test := range []struct {
+		path        string
+		contentType string
+		body        string
+		expected    string
+	}{
+		{"/struct", "application/json; charset=utf-8", `{"String":"json"}`, "json"},
+		{"/struct", "Application/JSON", `{"String":"json"}`, "json"},
+		{"/struct", "application/vnd.api+json", `{"String":"vnd"}`, "vnd"},
+		{"/struct", "application/problem+xml", `<Struct><String>problem</String></Struct>`, "problem"},
+		{"/struct", "text/xml; charset=utf-8", `<Struct><String>xml</String></Struct>`, "xml"},
+		{"/struct", "application/x-test", `custom`, "CUSTOM"},
+		{"/string", "text/plain; charset=utf-8", "Grüße", "Grüße"},
+		{"/string", "text/plain; charset=ISO-8859-1", "Gr\xfc\xdfe", "Grüße"},
+		{"/string", "text/plain; charset=utf-16le", "\xff\xfeG\x00r\x00\xfc\x00", "Grü"},
+		{"/string", "text/plain; charset=utf-16", "\x00G\x00r\x00\xfc", "Grü"},
+		{"/struct", "application/x-www-form-urlencoded; charset=iso-8859-1", "String=Gr%FC%DFe", "Grüße"},
+		{"/values", "application/x-www-form-urlencoded; charset=latin1", "name=%E4", "ä"},
+		{"/struct?String=%C3%A4", "application/x-www-form-urlencoded; charset=iso-8859-1", "Int=1", "ä"},
+	} {
+		recorder := serveBody(server, "POST", test.path, test.contentType, test.body)
+		if recorder.Code != http.StatusOK || recorder.Body.String() != test.expected {
+			t.Errorf("POST %s %s: expected %s, got %d %s", test.path, test.contentType, test.expected, recorder.Code, recorder.Body)
+		}
+	}
+
+	if recorder := serveBody(server, "POST", "/struct", "application/vnd.unknown+yaml", `String: x`); recorder.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("unknown suffix: expected 415, got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestCharsetReader(t *testing.T) {
+	defer func(charsetReader func(string, io.Reader) (io.Reader, error)) { CharsetReader = charsetReader }(CharsetReader)
+	CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		var buf bytes.Buffer
+		buf.ReadFrom(input)
+		return strings.NewReader(strings.ToUpper(charset) + ":" + buf.String()), nil
+	}
+
+	server := NewServer()
+	server.HandlePOST("/string", func(in string) string { return in })
+	recorder := serveBody(server, "POST", "/string", "text/plain; charset=koi8-r", "text")
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "KOI8-R:text" {
+		t.Errorf("expected KOI8-R:text, got %d %s", recorder.Code, recorder.Body)
+	}
+}
@@ -0,0 +1,245 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MarshalFunc marshals a handler result for a response media type.
+type MarshalFunc func(v interface{}) ([]byte, error)
+
+type encoder struct {
+	mediaType string
+	marshal   MarshalFunc
+}
+
+var (
+	encoders = []encoder{
+		{"application/json", marshalJSON},
+		{"application/xml", xml.Marshal},
+		{"text/xml", xml.Marshal},
+	}
+	encodersMutex sync.RWMutex
+)
+
+/*
+RegisterEncoder registers marshal as encoder for handler results
+of the response media type mediaType, like "application/yaml".
+An already registered encoder for mediaType will be replaced.
+
+Struct results of handlers will be marshalled with the encoder
+that matches the Accept header of the request best.
+If the request has no Accept header or several encoders match
+with the same quality, then the first registered of them
+will be used, which is JSON by default.
+If no encoder matches the Accept header or can marshal
+the result type, then a 406 not acceptable response will be sent.
+
+The default XML encoder uses encoding/xml, which ignores json tags.
+Fields hidden from JSON with json:"-" must be tagged with xml:"-"
+to be hidden from XML too.
+
+Example:
+
+	rest.RegisterEncoder("application/yaml", yaml.Marshal)
+*/
+func RegisterEncoder(mediaType string, marshal MarshalFunc) {
+	encodersMutex.Lock()
+	defer encodersMutex.Unlock()
+	for i := range encoders {
+		if encoders[i].mediaType == mediaType {
+			encoders[i].marshal = marshal
+			return
+		}
+	}
+	encoders = append(encoders, encoder{mediaType, marshal})
+}
+
+// marshalJSON marshals v as JSON indented with IndentJSON.
+func marshalJSON(v interface{}) ([]byte, error) {
+	j, err := json.Marshal(v)
+	if err != nil || IndentJSON == "" {
+		return j, err
+	}
+	var buf bytes.Buffer
+	err = json.Indent(&buf, j, "", IndentJSON)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// acceptRange is a media range of an Accept header.
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept returns the media ranges of an Accept header
+// sorted by descending quality and specificity.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		r := acceptRange{mediaType: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		if r.mediaType == "" {
+			continue
+		}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+	return ranges
+}
+
+// matches returns if mediaType is matched by the range.
+func (r acceptRange) matches(mediaType string) bool {
+	if r.mediaType == "*/*" || r.mediaType == mediaType {
+		return true
+	}
+	return strings.HasSuffix(r.mediaType, "/*") && strings.HasPrefix(mediaType, r.mediaType[:len(r.mediaType)-1])
+}
+
+// acceptableEncoders returns the registered encoders that are
+// acceptable by the Accept header of request, best match first.
+func acceptableEncoders(request *http.Request) []encoder {
+	encodersMutex.RLock()
+	defer encodersMutex.RUnlock()
+	qualities := acceptQualities(request, encoderMediaTypesLocked())
+	indices := make([]int, 0, len(encoders))
+	for i, q := range qualities {
+		if q > 0 {
+			indices = append(indices, i)
+		}
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return qualities[indices[i]] > qualities[indices[j]]
+	})
+	acceptable := make([]encoder, len(indices))
+	for i, index := range indices {
+		acceptable[i] = encoders[index]
+	}
+	return acceptable
+}
+
+// negotiate returns the index of the media type of offers
+// that matches the Accept header of request best,
+// or -1 if none of offers is acceptable.
+// Offers with the same quality are preferred in their order,
+// so if the request has no Accept header, the first offer is used.
+func negotiate(request *http.Request, offers []string) int {
+	best, bestQ := -1, 0.0
+	for i, q := range acceptQualities(request, offers) {
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best
+}
+
+// acceptQualities returns the quality of every media type of offers
+// by the most specific matching range of the Accept header of request.
+// Browsers accept text/html and application/xml with a higher quality
+// than */*, so if no offer is text/html, all offers acceptable
+// to a browser are treated with the same quality
+// to prefer JSON over XML when navigating to an API.
+func acceptQualities(request *http.Request, offers []string) []float64 {
+	qualities := make([]float64, len(offers))
+	header := request.Header.Get("Accept")
+	if header == "" {
+		for i := range qualities {
+			qualities[i] = 1
+		}
+		return qualities
+	}
+	ranges := parseAccept(header)
+	browser := false
+	for _, r := range ranges {
+		if r.mediaType == "text/html" && r.q > 0 {
+			browser = true
+		}
+	}
+	for _, offer := range offers {
+		if offer == "text/html" {
+			browser = false
+		}
+	}
+	for i, offer := range offers {
+		specificity := -1
+		for _, r := range ranges {
+			// Ranges with less wildcards are more specific
+			if s := 2 - strings.Count(r.mediaType, "*"); r.matches(offer) && s > specificity {
+				specificity, qualities[i] = s, r.q
+			}
+		}
+		if browser && qualities[i] > 0 {
+			qualities[i] = 1
+		}
+	}
+	return qualities
+}
+
+// writeEncoded writes v marshalled with the encoder
+// negotiated by the Accept header of request.
+// If an acceptable encoder can't marshal the type of v,
+// like XML for maps, then the next acceptable encoder is used.
+func writeEncoded(writer http.ResponseWriter, request *http.Request, v interface{}) {
+	writer.Header().Add("Vary", "Accept")
+	for _, enc := range acceptableEncoders(request) {
+		data, err := enc.marshal(v)
+		if isUnsupportedTypeError(err) {
+			continue
+		}
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+		writer.Header().Set("Content-Type", enc.mediaType)
+		writer.Write(data)
+		return
+	}
+	writeError(writer, NewHTTPError(http.StatusNotAcceptable, "no acceptable media type for %q and %T, available are %s", request.Header.Get("Accept"), v, strings.Join(encoderMediaTypes(), ", ")))
+}
+
+// isUnsupportedTypeError returns if err is returned
+// by encoding/json or encoding/xml for a type
+// that they can't marshal.
+func isUnsupportedTypeError(err error) bool {
+	var jsonErr *json.UnsupportedTypeError
+	var xmlErr *xml.UnsupportedTypeError
+	return errors.As(err, &jsonErr) || errors.As(err, &xmlErr)
+}
+
+// encoderMediaTypes returns the media types of all registered encoders.
+func encoderMediaTypes() []string {
+	encodersMutex.RLock()
+	defer encodersMutex.RUnlock()
+	return encoderMediaTypesLocked()
+}
+
+func encoderMediaTypesLocked() []string {
+	mediaTypes := make([]string, len(encoders))
+	for i, e := range encoders {
+		mediaTypes[i] = e.mediaType
+	}
+	return mediaTypes
+}
@@ -0,0 +1,132 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseAccept(t *testing.T) {
+	ranges := parseAccept("text/*;q=0.5, application/xml, */*;q=0.1, application/json;q=0.9")
+	expected := []string{"application/xml", "application/json", "text/*", "*/*"}
+	if len(ranges) != len(expected) {
+		t.Fatalf("invalid ranges %v", ranges)
+	}
+	for i, r := range ranges {
+		if r.mediaType != expected[i] {
+			t.Errorf("range %d: expected %s, got %s", i, expected[i], r.mediaType)
+		}
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	RegisterEncoder("text/x-test", func(v interface{}) ([]byte, error) {
+		return []byte("test"), nil
+	})
+	server := NewServer()
+	server.HandleGET("/struct", func() *SubStruct {
+		return &SubStruct{A: 1, B: 2}
+	})
+
+	for _, c := range []struct {
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"", http.StatusOK, "application/json", `{"A":1,"B":2}`},
+		{"*/*", http.StatusOK, "application/json", `{"A":1,"B":2}`},
+		{"application/xml", http.StatusOK, "application/xml", `<SubStruct><A>1</A><B>2</B></SubStruct>`},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", http.StatusOK, "application/json", `{"A":1,"B":2}`},
+		{"application/xml, application/json", http.StatusOK, "application/json", `{"A":1,"B":2}`},
+		{"application/xml, */*;q=0.1", http.StatusOK, "application/xml", `<SubStruct><A>1</A><B>2</B></SubStruct>`},
+		{"application/json;q=0, */*", http.StatusOK, "application/xml", `<SubStruct><A>1</A><B>2</B></SubStruct>`},
+		{"text/x-test", http.StatusOK, "text/x-test", "test"},
+		{"image/png", http.StatusNotAcceptable, "application/json", ""},
+	} {
+		request := httptest.NewRequest("GET", "/struct", nil)
+		if c.accept != "" {
+			request.Header.Set("Accept", c.accept)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		if response.Code != c.status || response.Header().Get("Content-Type") != c.contentType || (c.body != "" && response.Body.String() != c.body) {
+			t.Errorf("Accept %q: invalid response %d %s %s", c.accept, response.Code, response.Header().Get("Content-Type"), response.Body)
+		}
+	}
+}
+
+func TestContentNegotiation_xmlUnsupportedType(t *testing.T) {
+	server := NewServer()
+	server.HandleGET("/map", func() map[string]int { return map[string]int{"a": 1} })
+
+	for accept, status := range map[string]int{
+		"application/xml":                         http.StatusNotAcceptable,
+		"application/xml, application/json;q=0.5": http.StatusOK,
+	} {
+		request := httptest.NewRequest("GET", "/map", nil)
+		request.Header.Set("Accept", accept)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		if response.Code != status {
+			t.Errorf("Accept %q: expected %d, got %d %s", accept, status, response.Code, response.Body)
+		}
+	}
+}
+
+type jsonMarshalerString string
+
+func (s jsonMarshalerString) MarshalJSON() ([]byte, error) {
+	return []byte(`{"s":"` + s + `"}`), nil
+}
+
+func TestResultKinds(t *testing.T) {
+	server := NewServer()
+	server.HandleGET("/slice", func() []SubStruct { return []SubStruct{{1, 2}, {3, 4}} })
+	server.HandleGET("/array", func() [2]string { return [2]string{"a", "b"} })
+	server.HandleGET("/map", func() map[string]int { return map[string]int{"a": 1} })
+	server.HandleGET("/int", func() (int, error) { return 42, nil })
+	server.HandleGET("/bool", func() bool { return true })
+	server.HandleGET("/marshaler", func() jsonMarshalerString { return "x" })
+	server.HandleGET("/bytes", func() []byte { return []byte{0, 1, 2} })
+	server.HandleGET("/error", func() error { return NotFound("") })
+	server.HandleGET("/noerror", func() error { return nil })
+
+	for _, c := range []struct {
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"/slice", http.StatusOK, "application/json", `[{"A":1,"B":2},{"A":3,"B":4}]`},
+		{"/array", http.StatusOK, "application/json", `["a","b"]`},
+		{"/map", http.StatusOK, "application/json", `{"a":1}`},
+		{"/int", http.StatusOK, "application/json", `42`},
+		{"/bool", http.StatusOK, "application/json", `true`},
+		{"/marshaler", http.StatusOK, "application/json", `{"s":"x"}`},
+		{"/bytes", http.StatusOK, "application/octet-stream", "\x00\x01\x02"},
+		{"/error", http.StatusNotFound, "application/json", `{"status":404,"message":"Not Found"}`},
+		{"/noerror", http.StatusOK, "", ""},
+	} {
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, httptest.NewRequest("GET", c.path, nil))
+		if response.Code != c.status || response.Header().Get("Content-Type") != c.contentType || response.Body.String() != c.body {
+			t.Errorf("GET %s: invalid response %d %s %q", c.path, response.Code, response.Header().Get("Content-Type"), response.Body)
+		}
+	}
+
+	for _, handler := range []interface{}{
+		func() chan<- int { return nil },
+		func() interface{} { return nil },
+		func() (int, string) { return 0, "" },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("handler %T must panic", handler)
+				}
+			}()
+			server.HandleGET("/invalid", handler)
+		}()
+	}
+}
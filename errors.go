@@ -0,0 +1,191 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+/*
+HTTPError is an error with a HTTP status code.
+If a handler returns an HTTPError, or an error wrapping one,
+then a response with Status and the HTTPError marshalled
+as JSON body will be written instead of a 500 internal server error.
+
+Details is optional and must be marshallable as JSON.
+
+Example:
+
+	rest.HandleGET("/users/{id:int}", func(id int) (*User, error) {
+		user, ok := users[id]
+		if !ok {
+			return nil, rest.NotFound("user %d not found", id)
+		}
+		return user, nil
+	})
+*/
+type HTTPError struct {
+	Status  int         `json:"status"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// NewHTTPError returns an HTTPError with status and a message
+// formatted with fmt.Sprintf.
+// If format is empty, then the status text will be used as message.
+func NewHTTPError(status int, format string, args ...interface{}) *HTTPError {
+	message := http.StatusText(status)
+	if format != "" {
+		message = fmt.Sprintf(format, args...)
+	}
+	return &HTTPError{Status: status, Message: message}
+}
+
+// BadRequest returns an HTTPError with status 400.
+func BadRequest(format string, args ...interface{}) *HTTPError {
+	return NewHTTPError(http.StatusBadRequest, format, args...)
+}
+
+// Unauthorized returns an HTTPError with status 401.
+func Unauthorized(format string, args ...interface{}) *HTTPError {
+	return NewHTTPError(http.StatusUnauthorized, format, args...)
+}
+
+// Forbidden returns an HTTPError with status 403.
+func Forbidden(format string, args ...interface{}) *HTTPError {
+	return NewHTTPError(http.StatusForbidden, format, args...)
+}
+
+// NotFound returns an HTTPError with status 404.
+func NotFound(format string, args ...interface{}) *HTTPError {
+	return NewHTTPError(http.StatusNotFound, format, args...)
+}
+
+// Conflict returns an HTTPError with status 409.
+func Conflict(format string, args ...interface{}) *HTTPError {
+	return NewHTTPError(http.StatusConflict, format, args...)
+}
+
+// UnprocessableEntity returns an HTTPError with status 422.
+func UnprocessableEntity(format string, args ...interface{}) *HTTPError {
+	return NewHTTPError(http.StatusUnprocessableEntity, format, args...)
+}
+
+// InternalServerError returns an HTTPError with status 500.
+func InternalServerError(format string, args ...interface{}) *HTTPError {
+	return NewHTTPError(http.StatusInternalServerError, format, args...)
+}
+
+func (e *HTTPError) Error() string {
+	if e.Details != nil {
+		return fmt.Sprintf("%d %s: %v", e.Status, e.Message, e.Details)
+	}
+	return fmt.Sprintf("%d %s", e.Status, e.Message)
+}
+
+// badRequestError returns err as HTTPError if it is or wraps one,
+// else a 400 HTTPError for err.
+// fieldErrors are used as details of the HTTPError,
+// reading beyond the body size limit results in a 413 HTTPError.
+func badRequestError(err error) *HTTPError {
+	var e *HTTPError
+	if errors.As(err, &e) {
+		return e
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return requestTooLarge(maxBytesErr.Limit)
+	}
+	var details fieldErrors
+	if errors.As(err, &details) {
+		return &HTTPError{Status: http.StatusBadRequest, Message: "invalid parameters", Details: details}
+	}
+	return &HTTPError{Status: http.StatusBadRequest, Message: err.Error()}
+}
+
+// unsupportedMediaType returns a 415 HTTPError.
+func unsupportedMediaType(format string, args ...interface{}) *HTTPError {
+	return NewHTTPError(http.StatusUnsupportedMediaType, format, args...)
+}
+
+// decodeError returns a 400 HTTPError for an error decoding data
+// as JSON or XML with the field and value that could not be
+// unmarshalled as details.
+func decodeError(err error, data []byte) *HTTPError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "invalid JSON",
+			Details: fieldErrors{{Field: typeErr.Field, Value: jsonValueAt(data, typeErr.Offset), Reason: "expected " + typeErr.Type.String()}},
+		}
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return BadRequest("invalid JSON at offset %d: %s", syntaxErr.Offset, syntaxErr)
+	}
+	var xmlErr *xml.SyntaxError
+	if errors.As(err, &xmlErr) {
+		return BadRequest("invalid XML in line %d: %s", xmlErr.Line, xmlErr.Msg)
+	}
+	return badRequestError(err)
+}
+
+// jsonValueAt returns the value of the valid JSON data at the offset
+// of a json.UnmarshalTypeError, or an empty string if there is none.
+// The offset is after a literal value, or after the
+// opening delimiter of an object or array value.
+// Strings are returned unquoted, all other values as JSON.
+func jsonValueAt(data []byte, offset int64) string {
+	if offset <= 0 || offset > int64(len(data)) {
+		return ""
+	}
+	if c := data[offset-1]; c == '{' || c == '[' {
+		var raw json.RawMessage
+		if err := json.NewDecoder(bytes.NewReader(data[offset-1:])).Decode(&raw); err != nil {
+			return ""
+		}
+		return string(raw)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	for decoder.InputOffset() < offset {
+		start := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if decoder.InputOffset() != offset {
+			continue
+		}
+		if s, ok := token.(string); ok {
+			return s
+		}
+		return string(bytes.TrimLeft(data[start:offset], " \t\r\n:,"))
+	}
+	return ""
+}
+
+// writeError writes err as response.
+// If err is or wraps an HTTPError, then its status code will be used,
+// else 500 internal server error.
+// The body is the HTTPError marshalled as JSON.
+func writeError(writer http.ResponseWriter, err error) {
+	Log("ERROR:", err)
+	var e *HTTPError
+	if !errors.As(err, &e) {
+		e = &HTTPError{Status: http.StatusInternalServerError, Message: err.Error()}
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		// Details can't be marshalled
+		body, _ = json.Marshal(&HTTPError{Status: e.Status, Message: e.Message})
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.WriteHeader(e.Status)
+	writer.Write(body)
+}
@@ -0,0 +1,136 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveBody(server *Server, method, path, contentType, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestRequestErrors(t *testing.T) {
+	server := NewServer()
+	server.HandlePOST("/struct", func(in *Struct) *Struct { return in })
+	server.HandlePOST("/string", func(in string) string { return in })
+
+	for _, c := range []struct {
+		path, contentType, body string
+		status                  int
+		field                   string
+	}{
+		{"/struct", "application/json", `{"Int":`, http.StatusBadRequest, ""},
+		{"/struct", "application/json", `{"Int":"x"}`, http.StatusBadRequest, "Int"},
+		{"/struct", "application/xml", `<Struct><Int>`, http.StatusBadRequest, ""},
+		{"/struct", "application/x-www-form-urlencoded", `Int=x&Bool=true`, http.StatusBadRequest, "Int"},
+		{"/struct", "text/plain", `hello`, http.StatusUnsupportedMediaType, ""},
+		{"/struct", "image/png", `hello`, http.StatusUnsupportedMediaType, ""},
+		{"/string", "application/json", `{}`, http.StatusUnsupportedMediaType, ""},
+		{"/string", "", `a=b`, http.StatusUnsupportedMediaType, ""},
+		{"/struct", "application/json; charset=utf-8", `{"Int":"x"}`, http.StatusBadRequest, "Int"},
+		{"/struct", "application/json;;", `{}`, http.StatusBadRequest, ""},
+		{"/string", "text/plain; charset=klingon", `hello`, http.StatusUnsupportedMediaType, ""},
+	} {
+		response := serveBody(server, "POST", c.path, c.contentType, c.body)
+		if response.Code != c.status {
+			t.Errorf("POST %s %s %s: expected status %d, got %d", c.path, c.contentType, c.body, c.status, response.Code)
+			continue
+		}
+		var e struct {
+			Status  int
+			Message string
+			Details []fieldError
+		}
+		if err := json.Unmarshal(response.Body.Bytes(), &e); err != nil {
+			t.Errorf("POST %s %s: invalid error body %s", c.path, c.contentType, response.Body)
+			continue
+		}
+		if e.Status != c.status || e.Message == "" {
+			t.Errorf("POST %s %s: invalid error %+v", c.path, c.contentType, e)
+		}
+		if c.field != "" && (len(e.Details) != 1 || e.Details[0].Field != c.field) {
+			t.Errorf("POST %s %s: expected details for field %s, got %+v", c.path, c.contentType, c.field, e.Details)
+		}
+	}
+}
+
+func TestDecodeError_value(t *testing.T) {
+	for body, expected := range map[string]fieldError{
+		`{"Int":"x"}`:                       {"Int", "x", "expected int"},
+		`{"Int": "a \"b\"" , "String":"s"}`: {"Int", `a "b"`, "expected int"},
+		`{"String":12.5}`:                   {"String", "12.5", "expected string"},
+		`{"Bool":1}`:                        {"Bool", "1", "expected bool"},
+		`{"SubStruct":{"A":true}}`:          {"SubStruct.A", "true", "expected rest.MyIntType"},
+		`{"SubStruct":[1, 2]}`:              {"SubStruct", "[1, 2]", "expected rest.SubStruct"},
+		`{"Int":{"a":"}"}}`:                 {"Int", `{"a":"}"}`, "expected int"},
+	} {
+		var in Struct
+		err := decodeError(json.Unmarshal([]byte(body), &in), []byte(body))
+		details, _ := err.Details.(fieldErrors)
+		if len(details) != 1 || details[0] != expected {
+			t.Errorf("%s: expected %+v, got %+v", body, expected, err.Details)
+		}
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	var reported interface{}
+	OnPanic = func(request *http.Request, recovered interface{}, stack []byte) {
+		reported = recovered
+	}
+	defer func() { OnPanic = nil }()
+
+	server := NewServer()
+	server.HandleGET("/panic", func() string {
+		panic("boom")
+	})
+	response := serveBody(server, "GET", "/panic", "", "")
+	if response.Code != http.StatusInternalServerError || strings.Contains(response.Body.String(), "boom") {
+		t.Errorf("expected status 500, got %d %s", response.Code, response.Body)
+	}
+	if reported != "boom" {
+		t.Errorf("OnPanic not called, got %v", reported)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	server := NewServer()
+	server.HandleGET("/items/{id:int}", func(id int) (*Struct, error) {
+		if id == 1 {
+			return nil, fmt.Errorf("wrapped: %w", NotFound("item %d not found", id))
+		}
+		if id == 2 {
+			return nil, &HTTPError{Status: http.StatusForbidden, Message: "no", Details: map[string]int{"id": id}}
+		}
+		return nil, errors.New("plain error")
+	})
+
+	for _, c := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/items/1", http.StatusNotFound, `{"status":404,"message":"item 1 not found"}`},
+		{"/items/2", http.StatusForbidden, `{"status":403,"message":"no","details":{"id":2}}`},
+		{"/items/3", http.StatusInternalServerError, `{"status":500,"message":"plain error"}`},
+	} {
+		response := serveBody(server, "GET", c.path, "", "")
+		if response.Code != c.status || response.Body.String() != c.body {
+			t.Errorf("GET %s: expected %d %s, got %d %s", c.path, c.status, c.body, response.Code, response.Body)
+		}
+		if ct := response.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("GET %s: invalid Content-Type %s", c.path, ct)
+		}
+	}
+}
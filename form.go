@@ -0,0 +1,351 @@
+package rest
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// TimeFormats are the formats tried in order
+// to parse form and query values as time.Time.
+var TimeFormats = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"}
+
+// fieldError describes a request value that could not be
+// set at the struct field or argument named Field.
+type fieldError struct {
+	Field  string `json:"field"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// fieldErrors is an error listing all values of a request
+// that could not be parsed.
+type fieldErrors []fieldError
+
+func (errs fieldErrors) Error() string {
+	s := make([]string, len(errs))
+	for i, e := range errs {
+		s[i] = fmt.Sprintf("%s=%q: %s", e.Field, e.Value, e.Reason)
+	}
+	return "invalid parameters: " + strings.Join(s, ", ")
+}
+
+// fieldErrorReason returns err without the
+// function name prefix of strconv errors.
+func fieldErrorReason(err error) string {
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		return numErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// MaxFormIndex is the maximum slice index accepted in
+// form and query keys like items[0].name
+var MaxFormIndex = 1000
+
+/*
+setStructFields sets the fields of the struct v to values.
+
+A key names a field by its form tag, its json tag if it has
+no form tag, or its Go name if it has neither.
+Fields tagged with "-" are ignored.
+Fields of embedded structs are promoted like in Go.
+Nested struct fields are addressed by keys like SubStruct.A
+and slice elements by keys like items[0].name
+
+Slice fields get all values of a key, other fields the first value.
+Pointer fields are only allocated if there is a value for them.
+Supported field types are strings, bools, numbers, time.Time,
+types implementing encoding.TextUnmarshaler,
+and pointers and slices of those.
+
+Keys that don't match a field are ignored.
+Values that can't be parsed as the field type
+are returned as fieldErrors.
+*/
+func setStructFields(v reflect.Value, values url.Values) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var errs fieldErrors
+	for _, key := range keys {
+		if len(values[key]) == 0 {
+			continue
+		}
+		path, ok := parseFormKey(key)
+		if !ok || !hasFormField(v.Type(), path) {
+			continue
+		}
+		f, err := formField(v, path)
+		if err != nil {
+			errs = append(errs, fieldError{Field: key, Value: values[key][0], Reason: err.Error()})
+			continue
+		}
+		if value, err := setFieldValues(f, values[key]); err != nil {
+			errs = append(errs, fieldError{Field: key, Value: value, Reason: fieldErrorReason(err)})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// formKeyPart is a field name or a slice index if name is empty.
+type formKeyPart struct {
+	name  string
+	index int
+}
+
+// parseFormKey splits a key like items[0].name or SubStruct.A
+// into the field names and slice indices of its path.
+// Empty brackets like in tags[] are ignored,
+// non numeric brackets like in a[b] are treated as field names.
+func parseFormKey(key string) (path []formKeyPart, ok bool) {
+	for key != "" {
+		switch key[0] {
+		case '.':
+			key = key[1:]
+		case '[':
+			end := strings.IndexByte(key, ']')
+			if end == -1 {
+				return nil, false
+			}
+			inner := key[1:end]
+			key = key[end+1:]
+			if inner == "" {
+				continue
+			}
+			if index, err := strconv.Atoi(inner); err == nil {
+				if index < 0 {
+					return nil, false
+				}
+				path = append(path, formKeyPart{index: index})
+			} else {
+				path = append(path, formKeyPart{name: inner})
+			}
+		default:
+			end := strings.IndexAny(key, ".[")
+			if end == -1 {
+				end = len(key)
+			}
+			path = append(path, formKeyPart{name: key[:end]})
+			key = key[end:]
+		}
+	}
+	return path, len(path) > 0 && path[0].name != ""
+}
+
+// hasFormField returns if path addresses a field of the struct type t.
+func hasFormField(t reflect.Type, path []formKeyPart) bool {
+	for _, part := range path {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if part.name == "" {
+			if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+				return false
+			}
+			t = t.Elem()
+			continue
+		}
+		if t.Kind() != reflect.Struct || t == timeType {
+			return false
+		}
+		index, ok := structFormFields(t)[part.name]
+		if !ok {
+			return false
+		}
+		t = t.FieldByIndex(index).Type
+	}
+	return true
+}
+
+// formField returns the field of the struct v addressed by path.
+// Nil pointers and too short slices along the path are allocated.
+func formField(v reflect.Value, path []formKeyPart) (reflect.Value, error) {
+	for _, part := range path {
+		v = allocPtr(v)
+		if part.name == "" {
+			if part.index > MaxFormIndex || (v.Kind() == reflect.Array && part.index >= v.Len()) {
+				return v, fmt.Errorf("index %d out of range", part.index)
+			}
+			if v.Kind() == reflect.Slice && part.index >= v.Len() {
+				grown := reflect.MakeSlice(v.Type(), part.index+1, part.index+1)
+				reflect.Copy(grown, v)
+				v.Set(grown)
+			}
+			v = v.Index(part.index)
+			continue
+		}
+		for _, i := range structFormFields(v.Type())[part.name] {
+			v = allocPtr(v).Field(i)
+		}
+	}
+	return v, nil
+}
+
+// allocPtr dereferences v and allocates nil pointers.
+func allocPtr(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+var formFieldsCache sync.Map // reflect.Type -> map[string][]int
+
+// structFormFields returns the field indices of the struct type t by key name.
+// See setStructFields for how the names are derived.
+func structFormFields(t reflect.Type) map[string][]int {
+	if fields, ok := formFieldsCache.Load(t); ok {
+		return fields.(map[string][]int)
+	}
+	fields := make(map[string][]int)
+	var embedded [][]int
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, tagged := formFieldName(field)
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && !tagged {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, field.Index)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		fields[name] = field.Index
+	}
+	// Promote the fields of embedded structs
+	// if not shadowed by fields of t
+	for _, index := range embedded {
+		ft := t.FieldByIndex(index).Type
+		if ft.Kind() == reflect.Ptr {
+			if t.FieldByIndex(index).PkgPath != "" {
+				continue // can't allocate unexported embedded pointer
+			}
+			ft = ft.Elem()
+		}
+		if ft == t {
+			continue // recursive type
+		}
+		for name, subIndex := range structFormFields(ft) {
+			if _, exists := fields[name]; !exists {
+				fields[name] = append(append([]int(nil), index...), subIndex...)
+			}
+		}
+	}
+	formFieldsCache.Store(t, fields)
+	return fields
+}
+
+// formFieldName returns the key name of field
+// and if the name comes from a form or json tag.
+func formFieldName(field reflect.StructField) (name string, tagged bool) {
+	for _, tag := range []string{"form", "json"} {
+		if name = strings.Split(field.Tag.Get(tag), ",")[0]; name != "" {
+			return name, true
+		}
+	}
+	return field.Name, false
+}
+
+// setFieldValues sets values at the field f and returns
+// the value that could not be parsed in case of an error.
+func setFieldValues(f reflect.Value, values []string) (string, error) {
+	if f.Kind() == reflect.Slice && f.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(f.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setFieldValue(slice.Index(i), value); err != nil {
+				return value, err
+			}
+		}
+		f.Set(slice)
+		return "", nil
+	}
+	return values[0], setFieldValue(f, values[0])
+}
+
+// setFieldValue parses s as the type of f and sets it.
+func setFieldValue(f reflect.Value, s string) error {
+	t := f.Type()
+	if t.Kind() == reflect.Ptr {
+		p := reflect.New(t.Elem())
+		if err := setFieldValue(p.Elem(), s); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+	if t == timeType {
+		for _, format := range TimeFormats {
+			if tm, err := time.Parse(format, s); err == nil {
+				f.Set(reflect.ValueOf(tm))
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid time format")
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return f.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch t.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		val, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(val)
+	case reflect.Float32, reflect.Float64:
+		val, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(val)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val, err := strconv.ParseInt(s, 0, t.Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(val)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		val, err := strconv.ParseUint(s, 0, t.Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(val)
+	case reflect.Slice: // []byte
+		f.SetBytes([]byte(s))
+	default:
+		return fmt.Errorf("unsupported type %s", t)
+	}
+	return nil
+}
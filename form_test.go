@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type queryStruct struct {
+	Name  string
+	Count int
+	Tags  []string
+	IDs   []uint
+	Limit *int
+	Since time.Time
+	Ratio float32
+	My    MyIntType
+}
+
+func TestSetStructFields(t *testing.T) {
+	var s queryStruct
+	values, _ := url.ParseQuery("Name=x&Count=3&Tags=a&Tags=b&IDs=1&IDs=2&Since=2012-11-01&Ratio=0.5&My=9&Unknown=1")
+	if err := setStructFields(reflectValue(&s), values); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "x" || s.Count != 3 || len(s.Tags) != 2 || s.Tags[1] != "b" || len(s.IDs) != 2 || s.IDs[1] != 2 || s.Ratio != 0.5 || s.My != 9 {
+		t.Errorf("invalid result %+v", s)
+	}
+	if s.Limit != nil {
+		t.Errorf("Limit must be nil without value")
+	}
+	if !s.Since.Equal(time.Date(2012, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("invalid time %s", s.Since)
+	}
+
+	values, _ = url.ParseQuery("Limit=5")
+	if err := setStructFields(reflectValue(&s), values); err != nil || s.Limit == nil || *s.Limit != 5 {
+		t.Errorf("invalid optional value %v %v", s.Limit, err)
+	}
+}
+
+func TestSetStructFields_errors(t *testing.T) {
+	var s queryStruct
+	values, _ := url.ParseQuery("Count=x&IDs=1&IDs=-2&Since=yesterday&Name=ok")
+	err := setStructFields(reflectValue(&s), values)
+	errs, ok := err.(fieldErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("expected 3 fieldErrors, got %v", err)
+	}
+	if errs[0].Field != "Count" || errs[0].Value != "x" || errs[0].Reason != "invalid syntax" {
+		t.Errorf("invalid error %+v", errs[0])
+	}
+	if errs[1].Field != "IDs" || errs[1].Value != "-2" {
+		t.Errorf("invalid error %+v", errs[1])
+	}
+	if s.Name != "ok" {
+		t.Errorf("valid values must be set despite errors")
+	}
+}
+
+func TestHandleGET_structQuery(t *testing.T) {
+	server := NewServer()
+	server.HandleGET("/query", func(q *queryStruct) *queryStruct {
+		return q
+	})
+	status, body := serve(server, "GET", "/query?Name=x&Tags=a&Tags=b")
+	if status != 200 || body != `{"Name":"x","Count":0,"Tags":["a","b"],"IDs":null,"Limit":null,"Since":"0001-01-01T00:00:00Z","Ratio":0,"My":0}` {
+		t.Errorf("invalid result %d %s", status, body)
+	}
+	status, body = serve(server, "GET", "/query?Count=many")
+	if status != 400 {
+		t.Errorf("expected status 400, got %d %s", status, body)
+	}
+}
+
+type taggedItem struct {
+	Name  string `json:"name"`
+	Count int    `form:"count" json:"cnt"`
+}
+
+type TaggedBase struct {
+	ID   int `json:"id"`
+	Name string
+}
+
+type taggedStruct struct {
+	TaggedBase
+	Name      string       `form:"user_name"`
+	Items     []taggedItem `json:"items"`
+	Ptr       *taggedItem  `json:"ptr,omitempty"`
+	Ignore    int          `json:"-"`
+	SubStruct SubStruct
+}
+
+func TestSetStructFields_tags(t *testing.T) {
+	var s taggedStruct
+	values, _ := url.ParseQuery("id=3&Name=base&user_name=x&items[1].name=b&items[0].name=a&items[0].count=2&ptr.cnt=5&Ignore=1&-=1&SubStruct.A=8&SubStruct[B]=9")
+	if err := setStructFields(reflectValue(&s), values); err != nil {
+		t.Fatal(err)
+	}
+	if s.ID != 3 || s.TaggedBase.Name != "base" || s.Name != "x" || s.Ignore != 0 {
+		t.Errorf("invalid result %+v", s)
+	}
+	if len(s.Items) != 2 || s.Items[0].Name != "a" || s.Items[0].Count != 2 || s.Items[1].Name != "b" {
+		t.Errorf("invalid items %+v", s.Items)
+	}
+	if s.Ptr != nil {
+		t.Errorf("ptr.cnt must not match a field with form tag count")
+	}
+	if s.SubStruct.A != 8 || s.SubStruct.B != 9 {
+		t.Errorf("invalid SubStruct %+v", s.SubStruct)
+	}
+
+	values, _ = url.ParseQuery("ptr.count=5&items[100000].name=x")
+	err := setStructFields(reflectValue(&s), values)
+	if s.Ptr == nil || s.Ptr.Count != 5 {
+		t.Errorf("invalid ptr %+v", s.Ptr)
+	}
+	if errs, ok := err.(fieldErrors); !ok || len(errs) != 1 || errs[0].Field != "items[100000].name" {
+		t.Errorf("expected index out of range error, got %v", err)
+	}
+}
+
+func reflectValue(ptr interface{}) reflect.Value {
+	return reflect.ValueOf(ptr).Elem()
+}
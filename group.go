@@ -0,0 +1,134 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+)
+
+/*
+Group returns a RouteGroup that registers handlers at DefaultServer
+with paths prefixed by prefix.
+
+Groups can be nested with RouteGroup.Group, the nested group
+uses the prefix and middleware of its parent group.
+Middleware added to a group with Use or With only wraps
+the handlers of the group and its nested groups.
+The middleware of a group is resolved when a handler is registered,
+so middleware added to a parent group after a nested group
+was created also wraps the handlers registered at the nested group
+afterwards.
+
+Example:
+
+	api := rest.Group("/api/v1")
+	api.Use(requireAuth)
+	api.HandleGET("/users", listUsers) // GET /api/v1/users
+
+	admin := api.Group("/admin")
+	admin.Use(requireAdmin)
+	admin.HandleDELETE("/users/{id:int}", deleteUser) // DELETE /api/v1/admin/users/{id:int}
+*/
+func Group(prefix string) *RouteGroup {
+	return DefaultServer.Group(prefix)
+}
+
+// Group returns a RouteGroup that registers handlers at server
+// with paths prefixed by prefix.
+// See the package function Group for details.
+func (server *Server) Group(prefix string) *RouteGroup {
+	return &RouteGroup{server: server, prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+// RouteGroup registers handlers at a Server with a common
+// path prefix and wrapped with the middleware of the group.
+type RouteGroup struct {
+	server     *Server
+	parent     *RouteGroup
+	prefix     string
+	middleware []func(http.Handler) http.Handler // without the middleware of parent
+}
+
+// Group returns a nested RouteGroup with the path prefix
+// of group followed by prefix and the middleware of group.
+func (group *RouteGroup) Group(prefix string) *RouteGroup {
+	return &RouteGroup{
+		server: group.server,
+		parent: group,
+		prefix: group.prefix + strings.TrimSuffix(prefix, "/"),
+	}
+}
+
+// Use adds middleware to the group that wraps the handlers
+// registered at the group and its nested groups afterwards.
+func (group *RouteGroup) Use(middleware ...func(http.Handler) http.Handler) {
+	group.middleware = append(group.middleware, middleware...)
+}
+
+// With returns a new RouteGroup with the path prefix of group
+// and the middleware of group followed by middleware.
+func (group *RouteGroup) With(middleware ...func(http.Handler) http.Handler) *RouteGroup {
+	return &RouteGroup{
+		server:     group.server,
+		parent:     group,
+		prefix:     group.prefix,
+		middleware: append([]func(http.Handler) http.Handler(nil), middleware...),
+	}
+}
+
+// chain returns the middleware of the parent groups
+// followed by the middleware of group.
+func (group *RouteGroup) chain() []func(http.Handler) http.Handler {
+	if group.parent == nil {
+		return append([]func(http.Handler) http.Handler(nil), group.middleware...)
+	}
+	return append(group.parent.chain(), group.middleware...)
+}
+
+// HandleGET registers a HTTP GET handler for path below the group prefix.
+// See the package function HandleGET for details.
+func (group *RouteGroup) HandleGET(path string, handler interface{}, object ...interface{}) {
+	group.server.handleWithQuery("GET", group.prefix+path, handler, object, group.chain())
+}
+
+// HandlePOST registers a HTTP POST handler for path below the group prefix.
+// See the package function HandlePOST for details.
+func (group *RouteGroup) HandlePOST(path string, handler interface{}, object ...interface{}) {
+	group.server.handleWithBody("POST", group.prefix+path, handler, object, group.chain())
+}
+
+// HandlePUT registers a HTTP PUT handler for path below the group prefix.
+// See the package function HandlePUT for details.
+func (group *RouteGroup) HandlePUT(path string, handler interface{}, object ...interface{}) {
+	group.server.handleWithBody("PUT", group.prefix+path, handler, object, group.chain())
+}
+
+// HandlePATCH registers a HTTP PATCH handler for path below the group prefix.
+// See the package function HandlePATCH for details.
+func (group *RouteGroup) HandlePATCH(path string, handler interface{}, object ...interface{}) {
+	group.server.handleWithBody("PATCH", group.prefix+path, handler, object, group.chain())
+}
+
+// HandleDELETE registers a HTTP DELETE handler for path below the group prefix.
+// See the package function HandleDELETE for details.
+func (group *RouteGroup) HandleDELETE(path string, handler interface{}, object ...interface{}) {
+	group.server.handleWithQuery("DELETE", group.prefix+path, handler, object, group.chain())
+}
+
+// HandleResource registers the resource methods of object
+// under prefix below the group prefix.
+// See the package function HandleResource for details.
+func (group *RouteGroup) HandleResource(prefix string, object interface{}) {
+	group.server.handleResource(group.prefix+prefix, object, group.chain())
+}
+
+// HandleSSE registers a server-sent events handler for path below the group prefix.
+// See the package function HandleSSE for details.
+func (group *RouteGroup) HandleSSE(path string, handler interface{}, object ...interface{}) {
+	group.server.handleSSE(group.prefix+path, handler, object, group.chain())
+}
+
+// HandleWebSocket registers a WebSocket endpoint for path below the group prefix.
+// See the package function HandleWebSocket for details.
+func (group *RouteGroup) HandleWebSocket(path string, handler interface{}, object ...interface{}) {
+	group.server.handleWebSocket(group.prefix+path, handler, object, group.chain())
+}
@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRouteGroup(t *testing.T) {
+	var trace []string
+	server := NewServer()
+	api := server.Group("/api/v1/")
+	api.Use(traceMiddleware("api", &trace))
+	api.HandleGET("/users/{id:int}", func(id int) string { return "user" })
+	admin := api.Group("/admin")
+	admin.Use(traceMiddleware("admin", &trace))
+	admin.HandleDELETE("/users/{id:int}", func(id int) string { return "deleted" })
+	admin.With(traceMiddleware("route", &trace)).HandlePOST("/users", func(in *Struct) string { return "created" })
+	server.Group("/api/v2").HandleGET("/users/{id:int}", func(id int) string { return "v2" })
+
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+		trace    string
+	}{
+		{"GET", "/api/v1/users/1", "user", "api GET /api/v1/users/{id:int}"},
+		{"DELETE", "/api/v1/admin/users/1", "deleted", "api DELETE /api/v1/admin/users/{id:int},admin DELETE /api/v1/admin/users/{id:int}"},
+		{"POST", "/api/v1/admin/users", "created", "api POST /api/v1/admin/users,admin POST /api/v1/admin/users,route POST /api/v1/admin/users"},
+		{"GET", "/api/v2/users/1", "v2", ""},
+	}
+	for _, test := range tests {
+		trace = nil
+		status, body := serve(server, test.method, test.path)
+		if status != http.StatusOK || body != test.expected || strings.Join(trace, ",") != test.trace {
+			t.Errorf("%s %s: expected %s %s, got %d %s %s", test.method, test.path, test.expected, test.trace, status, body, strings.Join(trace, ","))
+		}
+	}
+	if status, _ := serve(server, "GET", "/users/1"); status != http.StatusNotFound {
+		t.Errorf("GET /users/1: expected 404, got %d", status)
+	}
+}
+
+func TestRouteGroup_parentMiddlewareAddedLater(t *testing.T) {
+	var trace []string
+	server := NewServer()
+	api := server.Group("/api")
+	admin := api.Group("/admin")
+	route := admin.With(traceMiddleware("route", &trace))
+	api.Use(traceMiddleware("auth", &trace))
+	admin.HandleGET("/users", func() string { return "users" })
+	route.HandleGET("/stats", func() string { return "stats" })
+
+	for path, expected := range map[string]string{
+		"/api/admin/users": "auth GET /api/admin/users",
+		"/api/admin/stats": "auth GET /api/admin/stats,route GET /api/admin/stats",
+	} {
+		trace = nil
+		if status, _ := serve(server, "GET", path); status != http.StatusOK || strings.Join(trace, ",") != expected {
+			t.Errorf("GET %s: expected trace %s, got %d %s", path, expected, status, strings.Join(trace, ","))
+		}
+	}
+}
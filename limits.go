@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+var (
+	// MaxBodySize is the maximum size in bytes of request bodies
+	// decoded for HandlePOST, HandlePUT and HandlePATCH handlers,
+	// except multipart/form-data bodies.
+	// Larger requests get a 413 payload too large response.
+	// Zero disables the limit.
+	// Use the BodyLimit middleware to override it for routes.
+	MaxBodySize int64 = 10 << 20
+
+	// MaxMultipartSize is the maximum size in bytes
+	// of multipart/form-data request bodies including
+	// files that are spilled to disk.
+	// Larger requests get a 413 payload too large response.
+	// Zero disables the limit.
+	// Use the BodyLimit middleware to override it for routes.
+	MaxMultipartSize int64 = 100 << 20
+
+	// MaxMultipartMemory is the maximum number of bytes of the
+	// files of a multipart/form-data request that are held in memory,
+	// larger files are stored in temporary files on disk.
+	// Use the MultipartMemoryLimit middleware to override it for routes.
+	MaxMultipartMemory int64 = 10 << 20
+)
+
+type bodyLimitKey struct{}
+
+type multipartMemoryKey struct{}
+
+/*
+BodyLimit returns a middleware that sets the maximum size
+in bytes of the request bodies of the wrapped handlers,
+overriding MaxBodySize and MaxMultipartSize.
+Zero disables the limit.
+
+Example:
+
+	rest.With(rest.BodyLimit(1<<30)).HandlePOST("/videos", uploadVideo)
+*/
+func BodyLimit(maxBytes int64) func(http.Handler) http.Handler {
+	return contextValueMiddleware(bodyLimitKey{}, maxBytes)
+}
+
+// MultipartMemoryLimit returns a middleware that sets the maximum
+// number of bytes of multipart/form-data files held in memory
+// for the wrapped handlers, overriding MaxMultipartMemory.
+func MultipartMemoryLimit(maxBytes int64) func(http.Handler) http.Handler {
+	return contextValueMiddleware(multipartMemoryKey{}, maxBytes)
+}
+
+func contextValueMiddleware(key, value interface{}) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			next.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), key, value)))
+		})
+	}
+}
+
+// limitRequestBody limits the body of request to the
+// BodyLimit of the route, or MaxBodySize or MaxMultipartSize.
+// It returns a 413 HTTPError if the Content-Length
+// of the request is larger than the limit.
+// Reading beyond the limit results in a *http.MaxBytesError.
+func limitRequestBody(request *http.Request) error {
+	limit, ok := request.Context().Value(bodyLimitKey{}).(int64)
+	if !ok {
+		limit = MaxBodySize
+		// An invalid Content-Type is rejected when decoding the body
+		mediaType, _, _ := parseContentType(request)
+		if strings.HasPrefix(mediaType, "multipart/") {
+			limit = MaxMultipartSize
+		}
+	}
+	if limit <= 0 || request.Body == nil {
+		return nil
+	}
+	if request.ContentLength > limit {
+		return requestTooLarge(limit)
+	}
+	request.Body = http.MaxBytesReader(nil, request.Body, limit)
+	return nil
+}
+
+// multipartMemory returns the MultipartMemoryLimit
+// of the route of request or MaxMultipartMemory.
+func multipartMemory(request *http.Request) int64 {
+	if maxBytes, ok := request.Context().Value(multipartMemoryKey{}).(int64); ok {
+		return maxBytes
+	}
+	return MaxMultipartMemory
+}
+
+// requestTooLarge returns a 413 HTTPError.
+func requestTooLarge(limit int64) *HTTPError {
+	return NewHTTPError(http.StatusRequestEntityTooLarge, "request body larger than %d bytes", limit)
+}
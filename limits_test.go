@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimits(t *testing.T) {
+	defer func(maxBodySize int64) { MaxBodySize = maxBodySize }(MaxBodySize)
+	MaxBodySize = 16
+
+	server := NewServer()
+	server.HandlePOST("/default", func(in string) string { return in })
+	server.With(BodyLimit(64)).HandlePOST("/override", func(in string) string { return in })
+	server.With(BodyLimit(0)).HandlePOST("/unlimited", func(in string) string { return in })
+
+	small, large := `"0123456789"`, `"`+strings.Repeat("x", 40)+`"`
+	for _, test := range []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{"/default", small, http.StatusOK},
+		{"/default", large, http.StatusRequestEntityTooLarge},
+		{"/override", large, http.StatusOK},
+		{"/unlimited", strings.Repeat("x", 1000), http.StatusOK},
+	} {
+		recorder := serveBody(server, "POST", test.path, "text/plain", test.body)
+		if recorder.Code != test.status {
+			t.Errorf("POST %s with %d bytes: expected %d, got %d %s", test.path, len(test.body), test.status, recorder.Code, recorder.Body)
+		}
+	}
+
+	// Without Content-Length the body is limited while reading
+	request := httptest.NewRequest("POST", "/default", ioutil.NopCloser(strings.NewReader(large)))
+	request.Header.Set("Content-Type", "text/plain")
+	request.ContentLength = -1
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusRequestEntityTooLarge || !strings.Contains(recorder.Body.String(), "larger than 16 bytes") {
+		t.Errorf("chunked body: expected 413, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	// Multipart bodies are limited by MaxMultipartSize
+	// regardless of the case of the media type
+	server.HandlePOST("/multipart", func(in *Struct) string { return in.String })
+	contentType, body := multipartBody(t, map[string]string{"String": strings.Repeat("x", 40)}, nil)
+	contentType = strings.Replace(contentType, "multipart/form-data", "Multipart/Form-Data", 1)
+	recorder = serveBody(server, "POST", "/multipart", contentType, body)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != strings.Repeat("x", 40) {
+		t.Errorf("multipart body: expected 200, got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestMultipartMemoryLimit(t *testing.T) {
+	var memory int64
+	handler := MultipartMemoryLimit(1024)(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		memory = multipartMemory(request)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil))
+	if memory != 1024 {
+		t.Errorf("expected multipart memory limit 1024, got %d", memory)
+	}
+	if memory := multipartMemory(httptest.NewRequest("POST", "/", nil)); memory != MaxMultipartMemory {
+		t.Errorf("expected MaxMultipartMemory %d, got %d", MaxMultipartMemory, memory)
+	}
+}
@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// systemdListenFDsStart is the first file descriptor
+// passed by systemd socket activation.
+const systemdListenFDsStart = 3
+
+/*
+SystemdListeners returns the listeners passed to the process
+by systemd socket activation, in the order of the
+ListenStream entries of the socket unit.
+It returns no listeners if the process was not socket activated.
+The environment variables of socket activation are unset,
+so that child processes don't inherit them.
+
+Example:
+
+	listeners, err := rest.SystemdListeners()
+	if err != nil || len(listeners) == 0 {
+		log.Fatal("not socket activated ", err)
+	}
+	err = rest.RunServerGraceful("", nil, rest.Listener(listeners[0]))
+*/
+func SystemdListeners() ([]net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+	listeners := make([]net.Listener, 0, n)
+	for fd := systemdListenFDsStart; fd < systemdListenFDsStart+n; fd++ {
+		file := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		// FileListener duplicates the file descriptor
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("systemd file descriptor %d: %w", fd, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
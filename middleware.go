@@ -0,0 +1,117 @@
+package rest
+
+import (
+	"net/http"
+	"reflect"
+)
+
+/*
+RouteInfo describes the registration of the handler
+that serves a request.
+It is available to middleware via RequestRoute.
+*/
+type RouteInfo struct {
+	// Method is the registered request method
+	Method string
+	// Path is the registered path template like /users/{id:int}
+	Path string
+	// Handler is the registered handler function or method
+	Handler interface{}
+	// Args are the handler argument types without injected arguments
+	Args []reflect.Type
+	// Results are the handler result types
+	Results []reflect.Type
+
+	// protocol is "sse" or "websocket" for routes
+	// registered with HandleSSE or HandleWebSocket
+	protocol string
+}
+
+type routeInfoKey struct{}
+
+// RequestRoute returns the description of the route
+// that serves request, or nil if no route matched.
+func RequestRoute(request *http.Request) *RouteInfo {
+	info, _ := request.Context().Value(routeInfoKey{}).(*RouteInfo)
+	return info
+}
+
+// Routes returns the descriptions of all routes
+// registered at DefaultServer in the order of registration.
+func Routes() []*RouteInfo {
+	return DefaultServer.Routes()
+}
+
+// Routes returns the descriptions of all routes
+// registered at server in the order of registration.
+func (server *Server) Routes() []*RouteInfo {
+	server.router.mutex.RLock()
+	defer server.router.mutex.RUnlock()
+	return append([]*RouteInfo(nil), server.router.infos...)
+}
+
+/*
+Use adds middleware that wraps all handlers of DefaultServer,
+including the ones registered before.
+The first middleware is the outermost one.
+Middleware also wraps the 404 not found and 405 method not allowed
+responses, so that it can answer CORS preflight requests for example.
+
+Middleware runs after the route of a request has been resolved,
+RequestRoute returns the route information for the request.
+
+Example:
+
+	rest.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if route := rest.RequestRoute(request); route != nil {
+				metrics.Count(route.Method + " " + route.Path)
+			}
+			next.ServeHTTP(writer, request)
+		})
+	})
+*/
+func Use(middleware ...func(http.Handler) http.Handler) {
+	DefaultServer.Use(middleware...)
+}
+
+/*
+With returns a RouteGroup that registers handlers at DefaultServer
+wrapped with middleware.
+The middleware of the group runs inside the middleware added with Use.
+
+Example:
+
+	rest.With(requireAuth).HandlePOST("/admin/users", createUser)
+*/
+func With(middleware ...func(http.Handler) http.Handler) *RouteGroup {
+	return DefaultServer.With(middleware...)
+}
+
+// Use adds middleware that wraps all handlers of server.
+// See the package function Use for details.
+func (server *Server) Use(middleware ...func(http.Handler) http.Handler) {
+	server.router.use(middleware)
+}
+
+// With returns a RouteGroup that registers handlers at server
+// wrapped with middleware.
+// See the package function With for details.
+func (server *Server) With(middleware ...func(http.Handler) http.Handler) *RouteGroup {
+	return server.Group("").With(middleware...)
+}
+
+// add registers handler wrapped with middleware
+// for the request method and template at server.
+func (server *Server) add(info *RouteInfo, template *pathTemplate, handler http.Handler, middleware []func(http.Handler) http.Handler) {
+	server.router.add(info.Method, template, chainMiddleware(middleware, handler), info)
+}
+
+// chainMiddleware wraps handler with middleware,
+// the first middleware will be the outermost handler.
+func chainMiddleware(middleware []func(http.Handler) http.Handler, handler http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
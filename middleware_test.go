@@ -0,0 +1,92 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// traceMiddleware returns a middleware that appends name
+// and the path of the resolved route to trace.
+func traceMiddleware(name string, trace *[]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			route := "-"
+			if info := RequestRoute(request); info != nil {
+				route = info.Method + " " + info.Path
+			}
+			*trace = append(*trace, name+" "+route)
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+func TestServer_Use(t *testing.T) {
+	var trace []string
+	server := NewServer()
+	server.HandleGET("/users/{id:int}", func(id int) string { return "user" })
+	server.Use(traceMiddleware("a", &trace), traceMiddleware("b", &trace))
+	admin := server.With(traceMiddleware("c", &trace))
+	admin.HandleDELETE("/users/{id:int}", func(id int) string { return "deleted" })
+	admin.With(traceMiddleware("d", &trace)).HandlePOST("/users", func(in *Struct) string { return "created" })
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		expected string
+	}{
+		{"GET", "/users/1", http.StatusOK, "a GET /users/{id:int},b GET /users/{id:int}"},
+		{"DELETE", "/users/1", http.StatusOK, "a DELETE /users/{id:int},b DELETE /users/{id:int},c DELETE /users/{id:int}"},
+		{"POST", "/users", http.StatusOK, "a POST /users,b POST /users,c POST /users,d POST /users"},
+		{"GET", "/unknown", http.StatusNotFound, "a -,b -"},
+		{"OPTIONS", "/users/1", http.StatusMethodNotAllowed, "a -,b -"},
+	}
+	for _, test := range tests {
+		trace = nil
+		status, _ := serve(server, test.method, test.path)
+		if status != test.status || strings.Join(trace, ",") != test.expected {
+			t.Errorf("%s %s: expected %d %s, got %d %s", test.method, test.path, test.status, test.expected, status, strings.Join(trace, ","))
+		}
+	}
+}
+
+func TestServer_UseShortCircuit(t *testing.T) {
+	server := NewServer()
+	server.With(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.URL.Query().Get("token") != "secret" {
+				writeError(writer, Unauthorized(""))
+				return
+			}
+			next.ServeHTTP(writer, request)
+		})
+	}).HandleGET("/private", func() string { return "private" })
+
+	if status, _ := serve(server, "GET", "/private"); status != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", status)
+	}
+	if status, body := serve(server, "GET", "/private?token=secret"); status != http.StatusOK || body != "private" {
+		t.Errorf("expected private, got %d %s", status, body)
+	}
+}
+
+func TestServer_UseConstructedOnce(t *testing.T) {
+	server := NewServer()
+	server.HandleGET("/", func() string { return "ok" })
+	constructed, served := 0, 0
+	server.Use(func(next http.Handler) http.Handler {
+		constructed++
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			served++
+			next.ServeHTTP(writer, request)
+		})
+	})
+	for i := 0; i < 3; i++ {
+		serve(server, "GET", "/")
+	}
+	serve(server, "GET", "/unknown")
+	if constructed != 1 || served != 4 {
+		t.Errorf("expected middleware constructed once and served 4 times, got %d and %d", constructed, served)
+	}
+}
@@ -0,0 +1,166 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/url"
+	"reflect"
+	"sort"
+)
+
+var (
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeaderSliceType = reflect.TypeOf([]*multipart.FileHeader(nil))
+	readCloserType      = reflect.TypeOf((*io.ReadCloser)(nil)).Elem()
+	bytesType           = reflect.TypeOf([]byte(nil))
+)
+
+/*
+setMultipartFields sets the fields of the struct v
+to the values and files of a multipart form.
+
+Values are set like with setStructFields.
+Files are set at fields with the same key names and one of the types:
+
+	*multipart.FileHeader     the first file of the key
+	[]*multipart.FileHeader   all files of the key
+	io.ReadCloser             the opened first file of the key
+	[]byte                    the content of the first file of the key
+
+For compatibility a file or single value named JSON
+is unmarshalled as JSON into v if v has no field named JSON.
+
+If an error is returned, then the already opened
+io.ReadCloser fields of v are closed.
+*/
+func setMultipartFields(v reflect.Value, form *multipart.Form) (err error) {
+	defer func() {
+		if err != nil {
+			closeFileFields(v, form)
+		}
+	}()
+	_, hasJSONField := structFormFields(v.Type())["JSON"]
+	if !hasJSONField {
+		if files := form.File["JSON"]; len(files) > 0 {
+			data, err := readFile(files[0])
+			if err != nil {
+				return err
+			}
+			if err = json.Unmarshal(data, v.Addr().Interface()); err != nil {
+				return decodeError(err, data)
+			}
+		} else if len(form.Value) == 1 && len(form.Value["JSON"]) == 1 && len(form.File) == 0 {
+			data := []byte(form.Value["JSON"][0])
+			if err := json.Unmarshal(data, v.Addr().Interface()); err != nil {
+				return decodeError(err, data)
+			}
+			return nil
+		}
+	}
+
+	var errs fieldErrors
+	if err := setStructFields(v, url.Values(form.Value)); err != nil {
+		fieldErrs, ok := err.(fieldErrors)
+		if !ok {
+			return err
+		}
+		errs = fieldErrs
+	}
+	keys := make([]string, 0, len(form.File))
+	for key := range form.File {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		files := form.File[key]
+		path, ok := parseFormKey(key)
+		if len(files) == 0 || !ok || !hasFormField(v.Type(), path) {
+			continue
+		}
+		f, err := formField(v, path)
+		if err == nil {
+			err = setFileField(f, files)
+		}
+		if err != nil {
+			errs = append(errs, fieldError{Field: key, Value: files[0].Filename, Reason: err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// setFileField sets files at the field f
+// that must have one of the file field types.
+func setFileField(f reflect.Value, files []*multipart.FileHeader) error {
+	switch f.Type() {
+	case fileHeaderType:
+		f.Set(reflect.ValueOf(files[0]))
+	case fileHeaderSliceType:
+		f.Set(reflect.ValueOf(files))
+	case readCloserType:
+		file, err := files[0].Open()
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(io.ReadCloser(file)))
+	case bytesType:
+		data, err := readFile(files[0])
+		if err != nil {
+			return err
+		}
+		f.SetBytes(data)
+	default:
+		return fmt.Errorf("unsupported file field type %s", f.Type())
+	}
+	return nil
+}
+
+func readFile(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+// cleanupMultipart closes the io.ReadCloser file fields
+// of the struct pointer args set from the files of form,
+// and removes the temporary files of form.
+// It has to be called after the handler has returned.
+func cleanupMultipart(form *multipart.Form, args []reflect.Value) {
+	closeFileArgs(form, args)
+	if err := form.RemoveAll(); err != nil {
+		Log("ERROR: can't remove multipart temporary files:", err)
+	}
+}
+
+// closeFileArgs closes the io.ReadCloser file fields
+// of the struct pointer args set from the files of form.
+func closeFileArgs(form *multipart.Form, args []reflect.Value) {
+	for _, arg := range args {
+		if arg.Kind() == reflect.Ptr && !arg.IsNil() && arg.Elem().Kind() == reflect.Struct {
+			closeFileFields(arg.Elem(), form)
+		}
+	}
+}
+
+// closeFileFields closes the io.ReadCloser fields
+// of the struct v set from the files of form.
+func closeFileFields(v reflect.Value, form *multipart.Form) {
+	for key := range form.File {
+		path, ok := parseFormKey(key)
+		if !ok || !hasFormField(v.Type(), path) {
+			continue
+		}
+		f, err := formField(v, path)
+		if err == nil && f.Type() == readCloserType && !f.IsNil() {
+			f.Interface().(io.Closer).Close()
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type uploadStruct struct {
+	Title       string                  `form:"title" validate:"required"`
+	Image       *multipart.FileHeader   `form:"image" validate:"required"`
+	Attachments []*multipart.FileHeader `form:"attachments"`
+	Reader      io.ReadCloser           `form:"reader"`
+	Data        []byte                  `form:"data"`
+}
+
+// multipartBody returns a multipart/form-data body with values and files
+// and its Content-Type with boundary.
+func multipartBody(t *testing.T, values map[string]string, files [][2]string) (contentType, body string) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for key, value := range values {
+		writer.WriteField(key, value)
+	}
+	for _, file := range files {
+		part, err := writer.CreateFormFile(file[0], file[0]+".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(file[1]))
+	}
+	writer.Close()
+	return writer.FormDataContentType(), buf.String()
+}
+
+func TestMultipartForm(t *testing.T) {
+	var reader io.ReadCloser
+	server := NewServer()
+	server.HandlePOST("/upload", func(in *uploadStruct) string {
+		content, _ := ioutil.ReadAll(in.Reader)
+		return fmt.Sprintf("%s %s %d %s %s", in.Title, in.Image.Filename, len(in.Attachments), content, in.Data)
+	})
+	server.With(MultipartMemoryLimit(1)).HandlePOST("/reader", func(in *struct{ Reader io.ReadCloser }) string {
+		reader = in.Reader
+		content, _ := ioutil.ReadAll(in.Reader)
+		return string(content)
+	})
+
+	contentType, body := multipartBody(t,
+		map[string]string{"title": "Hello"},
+		[][2]string{{"image", "PNG"}, {"attachments", "a"}, {"attachments", "b"}, {"reader", "stream"}, {"data", "bytes"}},
+	)
+	recorder := serveBody(server, "POST", "/upload", contentType, body)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "Hello image.txt 2 stream bytes" {
+		t.Errorf("expected 200 Hello image.txt 2 stream bytes, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	// Files larger than the memory limit are stored in temporary files
+	// that must be closed and removed after the handler returned
+	contentType, body = multipartBody(t, nil, [][2]string{{"Reader", "on disk"}})
+	recorder = serveBody(server, "POST", "/reader", contentType, body)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "on disk" {
+		t.Errorf("expected 200 on disk, got %d %s", recorder.Code, recorder.Body)
+	}
+	file, ok := reader.(*os.File)
+	if !ok {
+		t.Fatalf("expected file stored on disk, got %T", reader)
+	}
+	if _, err := file.Read(make([]byte, 1)); err == nil {
+		t.Error("expected closed file")
+	}
+	if _, err := os.Stat(file.Name()); !os.IsNotExist(err) {
+		t.Errorf("expected removed temporary file %s, got %v", file.Name(), err)
+	}
+
+	contentType, body = multipartBody(t, map[string]string{"title": "Hello"}, nil)
+	recorder = serveBody(server, "POST", "/upload", contentType, body)
+	if recorder.Code != http.StatusUnprocessableEntity || !strings.Contains(recorder.Body.String(), `"field":"image"`) {
+		t.Errorf("missing required file: expected 422 for image, got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestMultipartForm_errors(t *testing.T) {
+	defer func(maxMultipartSize int64) { MaxMultipartSize = maxMultipartSize }(MaxMultipartSize)
+	MaxMultipartSize = 1024
+
+	server := NewServer()
+	server.HandlePOST("/struct", func(in *Struct) *Struct { return in })
+
+	contentType, body := multipartBody(t, nil, [][2]string{{"JSON", `{"Int":1,"String":"json"}`}})
+	recorder := serveBody(server, "POST", "/struct", contentType, body)
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"String":"json"`) {
+		t.Errorf("JSON file: expected 200 with decoded struct, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	contentType, body = multipartBody(t, nil, [][2]string{{"String", "file"}})
+	recorder = serveBody(server, "POST", "/struct", contentType, body)
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "unsupported file field type string") {
+		t.Errorf("file for string field: expected 400, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	contentType, body = multipartBody(t, nil, [][2]string{{"data", strings.Repeat("x", 2048)}})
+	recorder = serveBody(server, "POST", "/struct", contentType, body)
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("too large upload: expected 413, got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestSetMultipartFields_closeOnError(t *testing.T) {
+	contentType, body := multipartBody(t, nil, [][2]string{{"A", "on disk"}, {"B", "not a string field"}})
+	_, params, _ := mime.ParseMediaType(contentType)
+	form, err := multipart.NewReader(strings.NewReader(body), params["boundary"]).ReadForm(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer form.RemoveAll()
+
+	var in struct {
+		A io.ReadCloser
+		B string
+	}
+	if err := setMultipartFields(reflect.ValueOf(&in).Elem(), form); err == nil {
+		t.Fatal("expected error for file part of string field")
+	}
+	if in.A == nil {
+		t.Fatal("expected opened file")
+	}
+	if _, err := in.A.Read(make([]byte, 1)); err == nil {
+		t.Error("expected opened file to be closed after error")
+	}
+}
+
+// invalidUpload captures its Reader when validated
+// and always fails validation.
+type invalidUpload struct {
+	Reader io.ReadCloser
+}
+
+var validatedUploadReader io.ReadCloser
+
+func (in *invalidUpload) Validate() error {
+	validatedUploadReader = in.Reader
+	return fmt.Errorf("always invalid")
+}
+
+func TestMultipartForm_closeOnInvalid(t *testing.T) {
+	defer func() { validatedUploadReader = nil }()
+	server := NewServer()
+	// Only files on disk fail to read after Close
+	server.With(MultipartMemoryLimit(1)).HandlePOST("/upload", func(in *invalidUpload) string { return "called" })
+
+	contentType, body := multipartBody(t, nil, [][2]string{{"Reader", "upload"}})
+	recorder := serveBody(server, "POST", "/upload", contentType, body)
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d %s", recorder.Code, recorder.Body)
+	}
+	if validatedUploadReader == nil {
+		t.Fatal("expected opened file")
+	}
+	if _, err := validatedUploadReader.Read(make([]byte, 1)); err == nil {
+		t.Error("expected opened file to be closed after failed validation")
+	}
+}
@@ -0,0 +1,389 @@
+package rest
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+/*
+HandleOpenAPI registers a HTTP GET handler for path that serves
+an OpenAPI 3 document in JSON format describing all routes
+registered at DefaultServer, with title and version as API info.
+
+The document is generated from the RouteInfo of the routes
+for every request, so routes registered after HandleOpenAPI
+are included.
+Path parameters, query parameters of GET and DELETE handlers,
+request bodies of POST, PUT and PATCH handlers and responses
+are described with schemas derived from the argument and result types.
+Struct types are added as component schemas with properties
+named by their json tags.
+
+Example:
+
+	rest.HandleOpenAPI("/openapi.json", "Users API", "1.0.0")
+*/
+func HandleOpenAPI(path, title, version string) {
+	DefaultServer.HandleOpenAPI(path, title, version)
+}
+
+// HandleOpenAPI registers a handler for path that serves an
+// OpenAPI 3 document describing the routes of server.
+// See the package function HandleOpenAPI for details.
+func (server *Server) HandleOpenAPI(path, title, version string) {
+	// The route has no Handler so that it is not part of the document
+	info := &RouteInfo{Method: "GET", Path: path}
+	server.add(info, parsePathTemplate(path), http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		data, err := marshalJSON(server.openAPIDocument(title, version))
+		if err != nil {
+			writeError(writer, err)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write(data)
+	}), nil)
+}
+
+// openAPIObject is a generic JSON object of the OpenAPI document.
+type openAPIObject map[string]interface{}
+
+// openAPIGenerator collects the component schemas
+// of struct types while generating a document.
+type openAPIGenerator struct {
+	schemas openAPIObject
+	names   map[reflect.Type]string
+}
+
+// openAPIDocument returns the OpenAPI 3 document for the routes of server.
+func (server *Server) openAPIDocument(title, version string) openAPIObject {
+	gen := &openAPIGenerator{schemas: openAPIObject{}, names: make(map[reflect.Type]string)}
+	paths := openAPIObject{}
+	for _, info := range server.Routes() {
+		if info.Handler == nil {
+			continue
+		}
+		template := parsePathTemplate(info.Path)
+		path := openAPIPath(template)
+		item, ok := paths[path].(openAPIObject)
+		if !ok {
+			item = openAPIObject{}
+			paths[path] = item
+		}
+		item[strings.ToLower(info.Method)] = gen.operation(info, template)
+	}
+	return openAPIObject{
+		"openapi":    "3.0.3",
+		"info":       openAPIObject{"title": title, "version": version},
+		"paths":      paths,
+		"components": openAPIObject{"schemas": gen.schemas},
+	}
+}
+
+// openAPIPath returns the path of template with
+// parameters in OpenAPI format like /users/{id}.
+func openAPIPath(template *pathTemplate) string {
+	segments := make([]string, len(template.segments))
+	for i, s := range template.segments {
+		if s.param != "" {
+			segments[i] = "{" + s.param + "}"
+		} else {
+			segments[i] = s.literal
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// openAPIOperationID returns an ID like getUsersById
+// for the request method and template.
+func openAPIOperationID(method string, template *pathTemplate) string {
+	id := strings.ToLower(method)
+	for _, s := range template.segments {
+		name := s.literal
+		if s.param != "" {
+			name = "By_" + s.param
+		}
+		for _, word := range strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
+
+// operation returns the OpenAPI operation object for a route.
+func (gen *openAPIGenerator) operation(info *RouteInfo, template *pathTemplate) openAPIObject {
+	op := openAPIObject{"operationId": openAPIOperationID(info.Method, template)}
+
+	var params []interface{}
+	pathParamNames := make(map[string]bool)
+	for _, p := range template.params {
+		pathParamNames[p.param] = true
+		params = append(params, openAPIObject{
+			"name":     p.param,
+			"in":       "path",
+			"required": true,
+			"schema":   openAPIPathParamSchema(p.paramType),
+		})
+	}
+	args := info.Args
+	if len(template.params) > 0 && len(args) >= len(template.params) && isPathParamKind(args[0].Kind()) {
+		args = args[len(template.params):]
+	}
+
+	switch {
+	case info.protocol == "websocket":
+		op["description"] = "WebSocket endpoint"
+		op["responses"] = openAPIObject{"101": openAPIObject{"description": "Switching Protocols"}}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		return op
+
+	case info.Method == "POST" || info.Method == "PUT" || info.Method == "PATCH":
+		if len(args) == 1 {
+			op["requestBody"] = gen.requestBody(args[0])
+		}
+
+	case len(args) == 1 && args[0].Kind() == reflect.Ptr && args[0].Elem().Kind() == reflect.Struct:
+		params = append(params, gen.queryParams(args[0].Elem(), "", pathParamNames, nil)...)
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	responses := openAPIObject{
+		"default": openAPIObject{
+			"description": "Error",
+			"content":     openAPIObject{"application/json": openAPIObject{"schema": gen.schema(reflect.TypeOf(HTTPError{}))}},
+		},
+	}
+	if info.protocol == "sse" {
+		responses["200"] = openAPIObject{
+			"description": "Server-sent events with data of " + info.Results[0].Elem().String(),
+			"content":     openAPIObject{"text/event-stream": openAPIObject{"schema": openAPIObject{"type": "string"}}},
+		}
+	} else if len(info.Results) > 0 && info.Results[0] != errorType {
+		responses["200"] = gen.response(info.Results[0])
+	} else {
+		responses["200"] = openAPIObject{"description": "OK"}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// requestBody returns the OpenAPI request body object
+// for a POST, PUT or PATCH handler argument of type t.
+func (gen *openAPIGenerator) requestBody(t reflect.Type) openAPIObject {
+	content := openAPIObject{}
+	switch {
+	case t == urlValuesType:
+		content["application/x-www-form-urlencoded"] = openAPIObject{"schema": openAPIObject{
+			"type":                 "object",
+			"additionalProperties": openAPIObject{"type": "string"},
+		}}
+	case t.Kind() == reflect.String:
+		content["text/plain"] = openAPIObject{"schema": openAPIObject{"type": "string"}}
+	default:
+		schema := gen.schema(t)
+		for _, mediaType := range []string{"application/json", "application/xml", "application/x-www-form-urlencoded", "multipart/form-data"} {
+			content[mediaType] = openAPIObject{"schema": schema}
+		}
+	}
+	return openAPIObject{"required": true, "content": content}
+}
+
+// response returns the OpenAPI response object
+// for a handler result of type t.
+func (gen *openAPIGenerator) response(t reflect.Type) openAPIObject {
+	content := openAPIObject{}
+	switch {
+	case t.Implements(readerType) || t.Implements(writerToType):
+		content["*/*"] = openAPIObject{"schema": openAPIObject{"type": "string", "format": "binary"}}
+	case t.Kind() == reflect.Chan:
+		elem := gen.schema(t.Elem())
+		content["application/json"] = openAPIObject{"schema": openAPIObject{"type": "array", "items": elem}}
+		content["application/x-ndjson"] = openAPIObject{"schema": elem}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		content["application/octet-stream"] = openAPIObject{"schema": openAPIObject{"type": "string", "format": "binary"}}
+	case t.Kind() == reflect.String:
+		content["text/plain"] = openAPIObject{"schema": openAPIObject{"type": "string"}}
+	default:
+		schema := gen.schema(t)
+		for _, mediaType := range encoderMediaTypes() {
+			content[mediaType] = openAPIObject{"schema": schema}
+		}
+	}
+	return openAPIObject{"description": "OK", "content": content}
+}
+
+// queryParams returns the OpenAPI query parameter objects
+// for the form fields of the struct type t.
+// Fields of nested structs are named like SubStruct.A,
+// fields that are set from path parameters are skipped.
+func (gen *openAPIGenerator) queryParams(t reflect.Type, prefix string, skip map[string]bool, visited []reflect.Type) []interface{} {
+	for _, v := range visited {
+		if v == t {
+			return nil // recursive type
+		}
+	}
+	visited = append(visited, t)
+	fields := structFormFields(t)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var params []interface{}
+	for _, name := range names {
+		if skip[prefix+name] {
+			continue
+		}
+		ft := t.FieldByIndex(fields[name]).Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != timeType && !reflect.PtrTo(ft).Implements(textUnmarshalerType) {
+			params = append(params, gen.queryParams(ft, prefix+name+".", skip, visited)...)
+			continue
+		}
+		params = append(params, openAPIObject{
+			"name":   prefix + name,
+			"in":     "query",
+			"schema": gen.schema(ft),
+		})
+	}
+	return params
+}
+
+// openAPIPathParamSchema returns the schema
+// for a path parameter type like int or uuid.
+func openAPIPathParamSchema(paramType string) openAPIObject {
+	switch paramType {
+	case "int":
+		return openAPIObject{"type": "integer", "format": "int64"}
+	case "uint":
+		return openAPIObject{"type": "integer", "minimum": 0}
+	case "float":
+		return openAPIObject{"type": "number"}
+	case "uuid":
+		return openAPIObject{"type": "string", "format": "uuid"}
+	}
+	return openAPIObject{"type": "string"}
+}
+
+// schema returns the JSON schema for values of type t.
+// Named struct types are added to the component schemas
+// and referenced.
+func (gen *openAPIGenerator) schema(t reflect.Type) openAPIObject {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return openAPIObject{"type": "string", "format": "date-time"}
+	case t == fileHeaderType.Elem() || t == readCloserType:
+		return openAPIObject{"type": "string", "format": "binary"}
+	case isJSONMarshaler(t):
+		return openAPIObject{} // any value
+	case reflect.PtrTo(t).Implements(textUnmarshalerType) && t.Kind() != reflect.String:
+		return openAPIObject{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return openAPIObject{"type": "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return openAPIObject{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64:
+		return openAPIObject{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openAPIObject{"type": "integer", "minimum": 0}
+	case reflect.Float32:
+		return openAPIObject{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return openAPIObject{"type": "number", "format": "double"}
+	case reflect.String:
+		return openAPIObject{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return openAPIObject{"type": "string", "format": "byte"}
+		}
+		return openAPIObject{"type": "array", "items": gen.schema(t.Elem())}
+	case reflect.Array:
+		return openAPIObject{"type": "array", "items": gen.schema(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		return openAPIObject{"type": "object", "additionalProperties": gen.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return gen.structSchema(t)
+		}
+		name, ok := gen.names[t]
+		if !ok {
+			name = t.Name()
+			if _, taken := gen.schemas[name]; taken {
+				name = strings.Map(func(r rune) rune {
+					if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-' {
+						return r
+					}
+					return '_'
+				}, t.PkgPath()+"."+t.Name())
+			}
+			gen.names[t] = name
+			gen.schemas[name] = openAPIObject{} // placeholder for recursive types
+			gen.schemas[name] = gen.structSchema(t)
+		}
+		return openAPIObject{"$ref": "#/components/schemas/" + name}
+	}
+	return openAPIObject{} // interface{} can be any value
+}
+
+// structSchema returns the object schema for the struct type t
+// with properties named like encoding/json does.
+func (gen *openAPIGenerator) structSchema(t reflect.Type) openAPIObject {
+	properties := openAPIObject{}
+	gen.addStructProperties(t, properties)
+	return openAPIObject{"type": "object", "properties": properties}
+}
+
+func (gen *openAPIGenerator) addStructProperties(t reflect.Type, properties openAPIObject) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "-" && len(tag) == 1 {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				// Fields of embedded structs are promoted
+				// if not shadowed by fields of t
+				embedded := openAPIObject{}
+				gen.addStructProperties(ft, embedded)
+				for n, s := range embedded {
+					if _, exists := properties[n]; !exists {
+						properties[n] = s
+					}
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema := gen.schema(field.Type)
+		for _, option := range tag[1:] {
+			if option == "string" {
+				schema = openAPIObject{"type": "string"}
+			}
+		}
+		properties[name] = schema
+	}
+}
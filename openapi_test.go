@@ -0,0 +1,93 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestHandleOpenAPI(t *testing.T) {
+	server := NewServer()
+	server.HandleGET("/users/{id:int}", func(id int) (*taggedStruct, error) { return nil, nil })
+	server.HandleGET("/search", func(query *queryStruct) []Struct { return nil })
+	server.Group("/api").HandlePOST("/structs", func(in *Struct) string { return "" })
+	server.HandleSSE("/events", func() <-chan int { return nil })
+	server.HandleOpenAPI("/openapi.json", "Test API", "1.0")
+
+	status, body := serve(server, "GET", "/openapi.json")
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", status, body)
+	}
+	var doc struct {
+		OpenAPI string
+		Info    struct{ Title, Version string }
+		Paths   map[string]map[string]struct {
+			OperationID string
+			Parameters  []struct {
+				Name   string
+				In     string
+				Schema map[string]interface{}
+			}
+			RequestBody struct {
+				Content map[string]struct{ Schema map[string]interface{} }
+			}
+			Responses map[string]struct {
+				Content map[string]struct{ Schema map[string]interface{} }
+			}
+		}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.0.3" || doc.Info.Title != "Test API" || doc.Info.Version != "1.0" {
+		t.Errorf("invalid document header %s %v", doc.OpenAPI, doc.Info)
+	}
+	if _, ok := doc.Paths["/openapi.json"]; ok {
+		t.Errorf("document must not describe itself")
+	}
+
+	getUser := doc.Paths["/users/{id}"]["get"]
+	if getUser.OperationID != "getUsersById" || len(getUser.Parameters) != 1 || getUser.Parameters[0].In != "path" || getUser.Parameters[0].Schema["type"] != "integer" {
+		t.Errorf("invalid GET /users/{id} %+v", getUser)
+	}
+	if ref := getUser.Responses["200"].Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/taggedStruct" {
+		t.Errorf("invalid GET /users/{id} response schema %v", ref)
+	}
+	tagged := doc.Components.Schemas["taggedStruct"].Properties
+	for _, name := range []string{"id", "Name", "items", "ptr", "SubStruct"} {
+		if _, ok := tagged[name]; !ok {
+			t.Errorf("taggedStruct schema has no property %s: %v", name, tagged)
+		}
+	}
+	if _, ok := tagged["Ignore"]; ok {
+		t.Errorf("taggedStruct schema must not have property Ignore")
+	}
+
+	search := doc.Paths["/search"]["get"]
+	params := make(map[string]map[string]interface{})
+	for _, p := range search.Parameters {
+		params[p.Name] = p.Schema
+	}
+	if params["Count"]["type"] != "integer" || params["Tags"]["type"] != "array" || params["Since"]["format"] != "date-time" {
+		t.Errorf("invalid GET /search query parameters %v", params)
+	}
+	if schema := search.Responses["200"].Content["application/json"].Schema; schema["type"] != "array" {
+		t.Errorf("invalid GET /search response schema %v", schema)
+	}
+
+	post := doc.Paths["/api/structs"]["post"]
+	if ref := post.RequestBody.Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/Struct" {
+		t.Errorf("invalid POST /api/structs request body %v", ref)
+	}
+	if sub := doc.Components.Schemas["Struct"].Properties["SubStruct"]["$ref"]; sub != "#/components/schemas/SubStruct" {
+		t.Errorf("invalid Struct schema property SubStruct %v", sub)
+	}
+	if _, ok := doc.Paths["/events"]["get"].Responses["200"].Content["text/event-stream"]; !ok {
+		t.Errorf("invalid GET /events %+v", doc.Paths["/events"])
+	}
+}
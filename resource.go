@@ -0,0 +1,118 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+/*
+HandleResource registers the CRUD methods of object
+as handlers for a resource at the path prefix.
+
+The following methods of object are looked up by name
+and bound to object like the optional object argument
+of HandleGET and HandlePOST:
+
+	List    GET    prefix       func([url.Values]) ([result][, error])
+	Get     GET    prefix/{id}  func(id[, url.Values]) ([result][, error])
+	Create  POST   prefix       func(*struct|url.Values) ([result][, error])
+	Update  PUT    prefix/{id}  func(id, *struct|url.Values) ([result][, error])
+	Delete  DELETE prefix/{id}  func(id[, url.Values]) ([result][, error])
+
+The id argument can be of string, integer or float kind
+and has to be of the same kind for all methods.
+Requests with an id that can't be parsed as that kind
+result in a 404 error.
+
+Methods that object does not have are not registered
+and requests for them result in a 405 error.
+At least one of the methods must exist.
+
+Example:
+
+	rest.HandleResource("/users", &userStore)
+*/
+func HandleResource(prefix string, object interface{}) {
+	DefaultServer.HandleResource(prefix, object)
+}
+
+// HandleResource registers the CRUD methods of object
+// as handlers for a resource at the path prefix at server.
+// See the package function HandleResource for details.
+func (server *Server) HandleResource(prefix string, object interface{}) {
+	server.handleResource(prefix, object, nil)
+}
+
+func (server *Server) handleResource(prefix string, object interface{}, middleware []func(http.Handler) http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	objectType := reflect.TypeOf(object)
+	if objectType == nil || objectType.Kind() != reflect.Ptr {
+		panic(fmt.Errorf("HandleResource(): object must be a pointer, got %T", object))
+	}
+	itemPath := prefix + "/{id" + resourceIDType(objectType) + "}"
+	found := false
+	for _, m := range resourceMethods {
+		method, ok := objectType.MethodByName(m.name)
+		if !ok {
+			continue
+		}
+		found = true
+		path := prefix
+		if m.withID {
+			path = itemPath
+		}
+		if m.withBody {
+			server.handleWithBody(m.requestMethod, path, method.Func.Interface(), []interface{}{object}, middleware)
+		} else {
+			server.handleWithQuery(m.requestMethod, path, method.Func.Interface(), []interface{}{object}, middleware)
+		}
+	}
+	if !found {
+		panic(fmt.Errorf("HandleResource(): %s has none of the methods List, Get, Create, Update, Delete", objectType))
+	}
+}
+
+var resourceMethods = []struct {
+	name          string
+	requestMethod string
+	withID        bool
+	withBody      bool
+}{
+	{"List", "GET", false, false},
+	{"Get", "GET", true, false},
+	{"Create", "POST", false, true},
+	{"Update", "PUT", true, true},
+	{"Delete", "DELETE", true, false},
+}
+
+// resourceIDType returns the path parameter type suffix
+// for the id argument of the resource methods of objectType.
+func resourceIDType(objectType reflect.Type) string {
+	idType := ""
+	idMethod := ""
+	for _, m := range resourceMethods {
+		method, ok := objectType.MethodByName(m.name)
+		// In(0) is the receiver, In(1) the id
+		if !ok || !m.withID || method.Type.NumIn() < 2 || !isPathParamKind(method.Type.In(1).Kind()) {
+			continue
+		}
+		var t string
+		switch method.Type.In(1).Kind() {
+		case reflect.String:
+			t = ""
+		case reflect.Float32, reflect.Float64:
+			t = ":float"
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			t = ":uint"
+		default:
+			t = ":int"
+		}
+		if idMethod != "" && t != idType {
+			panic(fmt.Errorf("HandleResource(): id argument of %s and %s must be of the same kind", idMethod, m.name))
+		}
+		idType, idMethod = t, m.name
+	}
+	return idType
+}
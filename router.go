@@ -0,0 +1,416 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// pathParamTypes maps the type names that can be used
+// in path templates like /users/{id:int} to functions
+// that check if a path segment is valid for the type.
+var pathParamTypes = map[string]func(string) bool{
+	"string": func(s string) bool {
+		return s != ""
+	},
+	"int": func(s string) bool {
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err == nil
+	},
+	"uint": func(s string) bool {
+		_, err := strconv.ParseUint(s, 10, 64)
+		return err == nil
+	},
+	"float": func(s string) bool {
+		_, err := strconv.ParseFloat(s, 64)
+		return err == nil
+	},
+	"uuid": regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`).MatchString,
+}
+
+// pathSegment is a literal or parameter segment of a pathTemplate.
+type pathSegment struct {
+	literal   string
+	param     string
+	paramType string
+}
+
+// pathTemplate is a parsed path like /users/{id:int}/posts/{slug}
+type pathTemplate struct {
+	pattern  string
+	segments []pathSegment
+	params   []pathSegment
+}
+
+// parsePathTemplate parses pattern and panics if it is invalid.
+// A parameter segment has the format {name} or {name:type}
+// where type is one of the keys of pathParamTypes.
+// Without type, the parameter is a non empty string.
+func parsePathTemplate(pattern string) *pathTemplate {
+	template := &pathTemplate{pattern: pattern}
+	for _, s := range strings.Split(pattern, "/") {
+		if !strings.ContainsAny(s, "{}") {
+			template.segments = append(template.segments, pathSegment{literal: s})
+			continue
+		}
+		if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") || strings.Count(s, "{") != 1 || strings.Count(s, "}") != 1 {
+			panic(fmt.Errorf("invalid path template %s: a parameter must span the whole segment, got %s", pattern, s))
+		}
+		segment := pathSegment{param: s[1 : len(s)-1], paramType: "string"}
+		if i := strings.IndexByte(segment.param, ':'); i != -1 {
+			segment.param, segment.paramType = segment.param[:i], segment.param[i+1:]
+		}
+		if segment.param == "" {
+			panic(fmt.Errorf("invalid path template %s: empty parameter name", pattern))
+		}
+		if _, ok := pathParamTypes[segment.paramType]; !ok {
+			panic(fmt.Errorf("invalid path template %s: unknown parameter type %s", pattern, segment.paramType))
+		}
+		for _, p := range template.params {
+			if p.param == segment.param {
+				panic(fmt.Errorf("invalid path template %s: duplicate parameter %s", pattern, segment.param))
+			}
+		}
+		template.segments = append(template.segments, segment)
+		template.params = append(template.params, segment)
+	}
+	return template
+}
+
+// isStatic returns true if the template has no parameters.
+func (template *pathTemplate) isStatic() bool {
+	return len(template.params) == 0
+}
+
+// match returns the parameters of path if it matches the template.
+func (template *pathTemplate) match(path string) (params pathParams, ok bool) {
+	parts := strings.Split(path, "/")
+	if len(parts) != len(template.segments) {
+		return nil, false
+	}
+	for i, s := range template.segments {
+		if s.param == "" {
+			if parts[i] != s.literal {
+				return nil, false
+			}
+			continue
+		}
+		if !pathParamTypes[s.paramType](parts[i]) {
+			return nil, false
+		}
+		params = append(params, pathParam{name: s.param, value: parts[i]})
+	}
+	return params, true
+}
+
+type pathParam struct {
+	name  string
+	value string
+}
+
+// pathParams are the parameters captured by a
+// pathTemplate in the order of the template.
+type pathParams []pathParam
+
+// values returns the params as url.Values.
+func (params pathParams) values() url.Values {
+	values := make(url.Values, len(params))
+	for _, p := range params {
+		values.Set(p.name, p.value)
+	}
+	return values
+}
+
+type pathParamsKey struct{}
+
+// requestPathParams returns the params that
+// the router captured from the request path.
+func requestPathParams(request *http.Request) pathParams {
+	params, _ := request.Context().Value(pathParamsKey{}).(pathParams)
+	return params
+}
+
+// router dispatches requests by path and request method.
+// Static paths are matched before path templates,
+// path templates are matched in the order of registration.
+type router struct {
+	mutex      sync.RWMutex
+	static     map[string]*route
+	templates  []*route
+	middleware []func(http.Handler) http.Handler
+	chained    http.Handler // middleware wrapping serveResolved, nil without middleware
+	infos      []*RouteInfo // in the order of registration
+	fallback   *http.ServeMux
+}
+
+// route holds the handlers for a path template by request method.
+type route struct {
+	template *pathTemplate
+	handlers map[string]*routeHandler
+	methods  []string
+}
+
+// routeHandler is a handler registered for a request method
+// with the description of its registration.
+type routeHandler struct {
+	http.Handler
+	info *RouteInfo
+}
+
+// handler returns the handler for the request method or nil.
+// HEAD requests are handled by the GET handler if there is no HEAD handler.
+func (route *route) handler(method string) *routeHandler {
+	if handler, ok := route.handlers[method]; ok {
+		return handler
+	}
+	if handler, ok := route.handlers["GET"]; ok && method == "HEAD" {
+		return handler
+	}
+	if DontCheckRequestMethod {
+		return route.handlers[route.methods[0]]
+	}
+	return nil
+}
+
+// add registers handler for the request method and template.
+func (router *router) add(method string, template *pathTemplate, handler http.Handler, info *RouteInfo) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	var r *route
+	if template.isStatic() {
+		r = router.static[template.pattern]
+	} else {
+		for _, t := range router.templates {
+			if t.template.pattern == template.pattern {
+				r = t
+				break
+			}
+		}
+	}
+	if r == nil {
+		r = &route{template: template, handlers: make(map[string]*routeHandler)}
+		if template.isStatic() {
+			if router.static == nil {
+				router.static = make(map[string]*route)
+			}
+			router.static[template.pattern] = r
+		} else {
+			router.templates = append(router.templates, r)
+		}
+	}
+	if _, ok := r.handlers[method]; ok {
+		panic(fmt.Errorf("Handle%s(): path %s registered twice", method, template.pattern))
+	}
+	r.handlers[method] = &routeHandler{handler, info}
+	r.methods = append(r.methods, method)
+	router.infos = append(router.infos, info)
+}
+
+// lookup returns the route matching path and the captured path parameters.
+func (router *router) lookup(path string) (*route, pathParams) {
+	router.mutex.RLock()
+	defer router.mutex.RUnlock()
+	if r, ok := router.static[path]; ok {
+		return r, nil
+	}
+	for _, r := range router.templates {
+		if params, ok := r.template.match(path); ok {
+			return r, params
+		}
+	}
+	return nil, nil
+}
+
+// use adds middleware that wraps the handling of all requests.
+func (router *router) use(middleware []func(http.Handler) http.Handler) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	router.middleware = append(router.middleware, middleware...)
+	router.chained = chainMiddleware(router.middleware, http.HandlerFunc(serveResolved))
+}
+
+type resolvedHandlerKey struct{}
+
+// serveResolved calls the handler that router.ServeHTTP
+// resolved for the request, after the middleware of the router.
+func serveResolved(writer http.ResponseWriter, request *http.Request) {
+	request.Context().Value(resolvedHandlerKey{}).(http.Handler).ServeHTTP(writer, request)
+}
+
+// ServeHTTP dispatches the request to the handler of the matching route
+// wrapped with the middleware of the router.
+// The middleware also wraps the 404 and 405 error responses.
+// The middleware chain is built once by use, not per request,
+// so that state created by middleware constructors is kept.
+func (router *router) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	Log(request.Method, request.URL)
+	var handler http.Handler
+	ctx := request.Context()
+	route, params := router.lookup(request.URL.Path)
+	if route == nil {
+		handler = router.notFoundHandler(request)
+	} else if h := route.handler(request.Method); h == nil {
+		allow := strings.Join(route.methods, ", ")
+		handler = http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Allow", allow)
+			http.Error(writer, "405: Method Not Allowed", http.StatusMethodNotAllowed)
+		})
+	} else {
+		ctx = context.WithValue(ctx, routeInfoKey{}, h.info)
+		if params != nil {
+			ctx = context.WithValue(ctx, pathParamsKey{}, params)
+		}
+		handler = h
+	}
+	router.mutex.RLock()
+	chained := router.chained
+	router.mutex.RUnlock()
+	if chained == nil {
+		handler.ServeHTTP(writer, request.WithContext(ctx))
+		return
+	}
+	chained.ServeHTTP(writer, request.WithContext(context.WithValue(ctx, resolvedHandlerKey{}, handler)))
+}
+
+// notFoundHandler returns the handler of the fallback ServeMux
+// for a request without matching route, or http.NotFound.
+// DefaultServer is skipped if it is registered at the
+// fallback ServeMux to prevent an endless recursion.
+func (router *router) notFoundHandler(request *http.Request) http.Handler {
+	if router.fallback != nil {
+		if handler, pattern := router.fallback.Handler(request); pattern != "" && handler != http.Handler(DefaultServer) {
+			return handler
+		}
+	}
+	return http.HandlerFunc(http.NotFound)
+}
+
+// pathParamArgsFunc wraps the arguments function argsFunc
+// so that the params of template are passed to the handler.
+//
+// If the first handler argument is of a path parameter type
+// (string, integer or float kind), then the first handler arguments
+// receive the path parameters in the order of the template
+// and the remaining arguments are created by argsFunc.
+// Otherwise the path parameters are merged into the
+// url.Values or struct pointer argument created by argsFunc.
+func pathParamArgsFunc(method string, template *pathTemplate, in []reflect.Type, argsFunc func(string, []reflect.Type) getArgsFunc) getArgsFunc {
+	if template.isStatic() {
+		return argsFunc(method, in)
+	}
+	if len(in) == 0 || !isPathParamKind(in[0].Kind()) {
+		getArgs := argsFunc(method, in)
+		return func(request *http.Request) ([]reflect.Value, error) {
+			args, err := getArgs(request)
+			if err != nil || len(args) == 0 {
+				return args, err
+			}
+			return args, mergePathParams(args[0], requestPathParams(request))
+		}
+	}
+
+	if len(in) < len(template.params) {
+		panic(fmt.Errorf("Handle%s(): path %s has %d parameters but handler only %d arguments", method, template.pattern, len(template.params), len(in)))
+	}
+	for i, p := range template.params {
+		if !pathParamFitsType(p.paramType, in[i]) {
+			panic(fmt.Errorf("Handle%s(): path parameter {%s:%s} can't be passed as handler argument %d of type %s", method, p.param, p.paramType, i, in[i]))
+		}
+	}
+	paramTypes := in[:len(template.params)]
+	getOtherArgs := func(request *http.Request) ([]reflect.Value, error) { return nil, nil }
+	if len(in) > len(paramTypes) {
+		getOtherArgs = argsFunc(method, in[len(paramTypes):])
+	}
+	return func(request *http.Request) ([]reflect.Value, error) {
+		params := requestPathParams(request)
+		args := make([]reflect.Value, len(paramTypes), len(in))
+		for i, t := range paramTypes {
+			arg, err := parsePathParam(params[i].value, t)
+			if err != nil {
+				return nil, fieldErrors{{Field: params[i].name, Value: params[i].value, Reason: fieldErrorReason(err)}}
+			}
+			args[i] = arg
+		}
+		otherArgs, err := getOtherArgs(request)
+		if err != nil {
+			return nil, err
+		}
+		return append(args, otherArgs...), nil
+	}
+}
+
+func isPathParamKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// pathParamFitsType returns if a path parameter of paramType
+// can be passed as argument of type t.
+func pathParamFitsType(paramType string, t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String:
+		return paramType == "string" || paramType == "uuid"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return paramType == "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return paramType == "uint"
+	case reflect.Float32, reflect.Float64:
+		return paramType == "float" || paramType == "int" || paramType == "uint"
+	}
+	return false
+}
+
+// parsePathParam converts value to a reflect.Value of type t.
+func parsePathParam(value string, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetFloat(f)
+	}
+	return v, nil
+}
+
+// mergePathParams sets params at arg if arg is
+// url.Values or a struct pointer.
+func mergePathParams(arg reflect.Value, params pathParams) error {
+	switch {
+	case arg.Type() == urlValuesType:
+		values := arg.Interface().(url.Values)
+		for _, p := range params {
+			values.Set(p.name, p.value)
+		}
+	case arg.Kind() == reflect.Ptr && arg.Elem().Kind() == reflect.Struct:
+		return setStructFields(arg.Elem(), params.values())
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestPathTemplate_match(t *testing.T) {
+	template := parsePathTemplate("/users/{id:int}/posts/{slug}")
+	params, ok := template.match("/users/42/posts/hello")
+	if !ok || len(params) != 2 || params[0].value != "42" || params[1].value != "hello" {
+		t.Errorf("invalid match result %v %v", params, ok)
+	}
+	for _, path := range []string{"/users/x/posts/hello", "/users/42/posts/", "/users/42/posts", "/users/42/posts/hello/x", "/people/42/posts/hello"} {
+		if _, ok := template.match(path); ok {
+			t.Errorf("%s must not match %s", path, template.pattern)
+		}
+	}
+
+	template = parsePathTemplate("/items/{id:uuid}")
+	if _, ok := template.match("/items/123e4567-e89b-12d3-a456-426614174000"); !ok {
+		t.Errorf("uuid must match %s", template.pattern)
+	}
+	if _, ok := template.match("/items/123e4567"); ok {
+		t.Errorf("invalid uuid must not match %s", template.pattern)
+	}
+}
+
+func TestPathTemplate_invalid(t *testing.T) {
+	for _, pattern := range []string{"/a/{id:bool}", "/a/x{id}", "/a/{}", "/a/{id}/{id}"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("parsePathTemplate(%s) must panic", pattern)
+				}
+			}()
+			parsePathTemplate(pattern)
+		}()
+	}
+}
+
+func TestPathParamArgsFunc_typeMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("string path parameter for int argument must panic")
+		}
+	}()
+	HandleGET("/mismatch/{id}", func(id int) string { return "" })
+}
+
+func TestPathParamArgsFunc_stringBodyArgument(t *testing.T) {
+	server := NewServer()
+	server.HandlePOST("/notes/{id}", func(id, body string) string { return id + " " + body })
+	recorder := serveBody(server, "POST", "/notes/7", "text/plain", "text")
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "7 text" {
+		t.Errorf("expected 7 text, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("string argument receiving the path parameter instead of the body must panic")
+		}
+	}()
+	server.HandlePOST("/other/{id}", func(body string) string { return body })
+}
+
+func serve(server *Server, method, path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestServer_methodDispatch(t *testing.T) {
+	server := NewServer()
+	server.HandleGET("/item", func() string { return "get" })
+	server.HandlePOST("/item", func(values url.Values) string { return "post" })
+	server.HandleGET("/item/{id}", func(id string) string { return "get " + id })
+	server.HandleGET("/item/new", func() string { return "new" })
+
+	for _, c := range []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/item", http.StatusOK, "get"},
+		{"POST", "/item", http.StatusOK, "post"},
+		{"HEAD", "/item", http.StatusOK, ""},
+		{"DELETE", "/item", http.StatusMethodNotAllowed, ""},
+		{"GET", "/item/x", http.StatusOK, "get x"},
+		{"GET", "/item/new", http.StatusOK, "new"},
+		{"GET", "/other", http.StatusNotFound, ""},
+	} {
+		status, body := serve(server, c.method, c.path)
+		if status != c.status || (c.body != "" && body != c.body) {
+			t.Errorf("%s %s: expected %d %q, got %d %q", c.method, c.path, c.status, c.body, status, body)
+		}
+	}
+}
+
+func TestDefaultServer_fallback(t *testing.T) {
+	http.HandleFunc("/fallback-test/", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("fallback"))
+	})
+	if status, body := serve(DefaultServer, "GET", "/fallback-test/file.txt"); status != http.StatusOK || body != "fallback" {
+		t.Errorf("expected fallback to http.DefaultServeMux, got %d %s", status, body)
+	}
+	if status, _ := serve(NewServer(), "GET", "/fallback-test/file.txt"); status != http.StatusNotFound {
+		t.Errorf("new servers must not fall back to http.DefaultServeMux, got %d", status)
+	}
+}
+
+func TestServer_independent(t *testing.T) {
+	a := NewServer()
+	b := NewServer()
+	a.HandleGET("/same", func() string { return "a" })
+	b.HandleGET("/same", func() string { return "b" })
+	if _, body := serve(a, "GET", "/same"); body != "a" {
+		t.Errorf("server a: invalid result %q", body)
+	}
+	if _, body := serve(b, "GET", "/same"); body != "b" {
+		t.Errorf("server b: invalid result %q", body)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("registering the same path and method twice must panic")
+		}
+	}()
+	a.HandleGET("/same", func() string { return "a" })
+}
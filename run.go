@@ -0,0 +1,284 @@
+package rest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ServerOption configures how a Server is run
+// by RunServerGraceful or RunServerTLS.
+type ServerOption func(*serverConfig)
+
+type serverConfig struct {
+	drainTimeout       time.Duration
+	signals            []os.Signal
+	tlsConfig          *tls.Config
+	clientCAs          *x509.CertPool
+	clientCertRequired bool
+	listener           net.Listener
+	readTimeout        time.Duration
+	readHeaderTimeout  time.Duration
+	writeTimeout       time.Duration
+	idleTimeout        time.Duration
+	maxHeaderBytes     int
+	disableKeepAlives  bool
+}
+
+var (
+	// DefaultDrainTimeout is the time in-flight requests
+	// have to finish when a server is stopped,
+	// if not configured otherwise with the DrainTimeout option.
+	DefaultDrainTimeout = 30 * time.Second
+
+	// DefaultReadHeaderTimeout is the time clients have to send
+	// the request headers, if not configured otherwise
+	// with the ReadHeaderTimeout option.
+	DefaultReadHeaderTimeout = 10 * time.Second
+
+	// DefaultIdleTimeout is the time idle keep-alive connections
+	// stay open, if not configured otherwise
+	// with the IdleTimeout option.
+	DefaultIdleTimeout = 2 * time.Minute
+)
+
+// DrainTimeout sets the time in-flight requests have to finish
+// after the server has been stopped.
+// Connections that are still active after timeout will be closed.
+// Zero waits without time limit.
+func DrainTimeout(timeout time.Duration) ServerOption {
+	return func(config *serverConfig) {
+		config.drainTimeout = timeout
+	}
+}
+
+// ShutdownOnSignals stops the server gracefully when
+// one of signals is received by the process.
+// Without arguments SIGINT and SIGTERM are used.
+func ShutdownOnSignals(signals ...os.Signal) ServerOption {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	return func(config *serverConfig) {
+		config.signals = signals
+	}
+}
+
+// ReadTimeout sets the maximum duration for reading
+// the entire request including the body.
+// Zero means no timeout, which is the default.
+func ReadTimeout(timeout time.Duration) ServerOption {
+	return func(config *serverConfig) {
+		config.readTimeout = timeout
+	}
+}
+
+// ReadHeaderTimeout sets the maximum duration for reading
+// the request headers. The default is DefaultReadHeaderTimeout.
+func ReadHeaderTimeout(timeout time.Duration) ServerOption {
+	return func(config *serverConfig) {
+		config.readHeaderTimeout = timeout
+	}
+}
+
+// WriteTimeout sets the maximum duration from the end of
+// reading the request headers until the end of writing the response.
+// Zero means no timeout, which is the default
+// because a write timeout also ends server-sent event streams.
+func WriteTimeout(timeout time.Duration) ServerOption {
+	return func(config *serverConfig) {
+		config.writeTimeout = timeout
+	}
+}
+
+// IdleTimeout sets the maximum time to wait for the next
+// request on a keep-alive connection.
+// The default is DefaultIdleTimeout.
+func IdleTimeout(timeout time.Duration) ServerOption {
+	return func(config *serverConfig) {
+		config.idleTimeout = timeout
+	}
+}
+
+// MaxHeaderBytes sets the maximum size of the request headers.
+// Zero uses http.DefaultMaxHeaderBytes.
+func MaxHeaderBytes(n int) ServerOption {
+	return func(config *serverConfig) {
+		config.maxHeaderBytes = n
+	}
+}
+
+// KeepAlives enables or disables HTTP keep-alive connections,
+// they are enabled by default.
+func KeepAlives(enabled bool) ServerOption {
+	return func(config *serverConfig) {
+		config.disableKeepAlives = !enabled
+	}
+}
+
+// Listener makes the server accept connections from listener
+// instead of listening on the address passed to RunServerGraceful
+// or RunServerTLS. Use it for Unix domain sockets
+// or the listeners of SystemdListeners.
+// The listener is closed when the server stops.
+func Listener(listener net.Listener) ServerOption {
+	return func(config *serverConfig) {
+		config.listener = listener
+	}
+}
+
+func newServerConfig(options []ServerOption) *serverConfig {
+	config := &serverConfig{
+		drainTimeout:      DefaultDrainTimeout,
+		readHeaderTimeout: DefaultReadHeaderTimeout,
+		idleTimeout:       DefaultIdleTimeout,
+	}
+	for _, option := range options {
+		option(config)
+	}
+	return config
+}
+
+// listen returns the Listener option or listens on addr.
+func (config *serverConfig) listen(addr string) (net.Listener, error) {
+	if config.listener != nil {
+		return config.listener, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// newHTTPServer returns a http.Server for handler
+// with the timeouts and limits of config.
+func (config *serverConfig) newHTTPServer(handler http.Handler) *http.Server {
+	httpServer := &http.Server{
+		Handler:           handler,
+		ReadTimeout:       config.readTimeout,
+		ReadHeaderTimeout: config.readHeaderTimeout,
+		WriteTimeout:      config.writeTimeout,
+		IdleTimeout:       config.idleTimeout,
+		MaxHeaderBytes:    config.maxHeaderBytes,
+	}
+	httpServer.SetKeepAlivesEnabled(!config.disableKeepAlives)
+	return httpServer
+}
+
+/*
+RunServerGraceful starts an HTTP server with a given address
+with the handlers registered at DefaultServer.
+It returns an error if the server could not be started
+or failed, instead of panicking like RunServer.
+
+If stop is non nil, then a send on the channel or closing it
+will stop the server gracefully: No new connections are accepted,
+server-sent event streams and WebSocket connections are closed,
+and in-flight requests are drained for DrainTimeout.
+RunServerGraceful returns after all connections have finished,
+or with an error if the drain timeout expired.
+
+The timeouts and limits of the server can be configured with the options
+ReadTimeout, ReadHeaderTimeout, WriteTimeout, IdleTimeout,
+MaxHeaderBytes and KeepAlives.
+The Listener option serves connections of an existing listener,
+like a Unix domain socket or a listener of SystemdListeners,
+instead of listening on addr.
+
+Example:
+
+	err := rest.RunServerGraceful(":8080", nil,
+		rest.ShutdownOnSignals(),
+		rest.DrainTimeout(10*time.Second),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+*/
+func RunServerGraceful(addr string, stop <-chan struct{}, options ...ServerOption) error {
+	return DefaultServer.RunServerGraceful(addr, stop, options...)
+}
+
+// RunServerGraceful starts an HTTP server with a given address
+// that serves the handlers registered at server.
+// See the package function RunServerGraceful for details.
+func (server *Server) RunServerGraceful(addr string, stop <-chan struct{}, options ...ServerOption) error {
+	config := newServerConfig(options)
+	listener, err := config.listen(addr)
+	if err != nil {
+		return err
+	}
+	return server.serve(config.newHTTPServer(server), listener, config, stop)
+}
+
+type shutdownKey struct{}
+
+// shutdownChan returns a channel from the context of request
+// that is closed when the RunServerGraceful or RunServerTLS call
+// serving the request stops, used to end long running
+// responses like server-sent events.
+// The channel is nil for requests not served by them.
+func shutdownChan(request *http.Request) <-chan struct{} {
+	shutdown, _ := request.Context().Value(shutdownKey{}).(<-chan struct{})
+	return shutdown
+}
+
+// serve serves httpServer on listener until it fails,
+// stop is signalled, or one of the signals of config is received.
+// It then shuts down httpServer gracefully.
+func (server *Server) serve(httpServer *http.Server, listener net.Listener, config *serverConfig, stop <-chan struct{}) error {
+	var signals chan os.Signal
+	if len(config.signals) > 0 {
+		signals = make(chan os.Signal, 1)
+		signal.Notify(signals, config.signals...)
+		defer signal.Stop(signals)
+	}
+
+	// Every call has its own shutdown channel, so that a server
+	// can be restarted or served on multiple listeners
+	shutdown := make(chan struct{})
+	httpServer.BaseContext = func(net.Listener) context.Context {
+		return context.WithValue(context.Background(), shutdownKey{}, (<-chan struct{})(shutdown))
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if httpServer.TLSConfig != nil {
+			// ServeTLS enables HTTP/2
+			serveErr <- httpServer.ServeTLS(listener, "", "")
+		} else {
+			serveErr <- httpServer.Serve(listener)
+		}
+	}()
+	Log("Server listening at", listener.Addr())
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-stop:
+	case sig := <-signals:
+		Log("Server received signal", sig)
+	}
+
+	Log("Server stopping, draining connections")
+	close(shutdown)
+	ctx := context.Background()
+	if config.drainTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.drainTimeout)
+		defer cancel()
+	}
+	if err := httpServer.Shutdown(ctx); err != nil {
+		httpServer.Close()
+		return fmt.Errorf("server stopped before all connections finished: %w", err)
+	}
+	if err := <-serveErr; err != http.ErrServerClosed {
+		return err
+	}
+	Log("Server stopped, all connections finished")
+	return nil
+}
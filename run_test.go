@@ -0,0 +1,229 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a local address with a free port.
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// startGraceful runs server with RunServerGraceful in the background
+// and waits until it accepts connections.
+func startGraceful(t *testing.T, server *Server, addr string, stop chan struct{}, options ...ServerOption) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- server.RunServerGraceful(addr, stop, options...)
+	}()
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return result
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server did not start")
+	return nil
+}
+
+func TestRunServerGraceful_drain(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := NewServer()
+	server.HandleGET("/slow", func() string {
+		close(started)
+		<-release
+		return "done"
+	})
+	addr := freeAddr(t)
+	stop := make(chan struct{})
+	result := startGraceful(t, server, addr, stop)
+
+	response := make(chan string, 1)
+	go func() {
+		r, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer r.Body.Close()
+		body, _ := ioutil.ReadAll(r.Body)
+		response <- string(body)
+	}()
+	<-started
+	close(stop)
+
+	select {
+	case err := <-result:
+		t.Fatalf("server stopped before in-flight request finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if body := <-response; body != "done" {
+		t.Errorf("in-flight request: expected done, got %s", body)
+	}
+	if err := <-result; err != nil {
+		t.Errorf("expected nil error, got %v", err)
+	}
+}
+
+func TestRunServerGraceful_drainTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server := NewServer()
+	server.HandleGET("/hanging", func() string {
+		close(started)
+		<-release
+		return "done"
+	})
+	addr := freeAddr(t)
+	stop := make(chan struct{})
+	result := startGraceful(t, server, addr, stop, DrainTimeout(50*time.Millisecond))
+
+	go http.Get("http://" + addr + "/hanging")
+	<-started
+	close(stop)
+	if err := <-result; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded error, got %v", err)
+	}
+}
+
+func TestRunServer_drainTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { DefaultDrainTimeout = timeout }(DefaultDrainTimeout)
+	DefaultDrainTimeout = 50 * time.Millisecond
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server := NewServer()
+	server.HandleGET("/hanging", func() string {
+		close(started)
+		<-release
+		return "done"
+	})
+	addr := freeAddr(t)
+	stop := make(chan struct{})
+	result := make(chan interface{}, 1)
+	go func() {
+		defer func() { result <- recover() }()
+		server.RunServer(addr, stop)
+	}()
+
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	go http.Get("http://" + addr + "/hanging")
+	<-started
+	close(stop)
+	if recovered := <-result; recovered != nil {
+		t.Errorf("expected RunServer to return after drain timeout, got panic %v", recovered)
+	}
+}
+
+func TestRunServerGraceful_listenError(t *testing.T) {
+	if err := NewServer().RunServerGraceful("invalid address", nil); err == nil {
+		t.Error("expected error for invalid address")
+	}
+}
+
+func TestRunServerGraceful_unixListener(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "rest.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("unix domain sockets not supported:", err)
+	}
+	server := NewServer()
+	server.HandleGET("/hello", func() string { return "hello" })
+	stop := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		result <- server.RunServerGraceful("", stop, Listener(listener), KeepAlives(false))
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	response, err := client.Get("http://unix/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "hello" || !response.Close {
+		t.Errorf("expected hello without keep-alive, got %s close=%v", body, response.Close)
+	}
+	close(stop)
+	if err := <-result; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServerConfig_newHTTPServer(t *testing.T) {
+	config := newServerConfig([]ServerOption{
+		ReadTimeout(time.Second),
+		WriteTimeout(2 * time.Second),
+		IdleTimeout(3 * time.Second),
+		MaxHeaderBytes(1024),
+	})
+	httpServer := config.newHTTPServer(NewServer())
+	if httpServer.ReadTimeout != time.Second || httpServer.ReadHeaderTimeout != DefaultReadHeaderTimeout ||
+		httpServer.WriteTimeout != 2*time.Second || httpServer.IdleTimeout != 3*time.Second || httpServer.MaxHeaderBytes != 1024 {
+		t.Errorf("invalid http.Server configuration %+v", httpServer)
+	}
+}
+
+func TestSystemdListeners_notActivated(t *testing.T) {
+	listeners, err := SystemdListeners()
+	if err != nil || listeners != nil {
+		t.Errorf("expected no listeners, got %v %v", listeners, err)
+	}
+}
+
+func TestRunServerGraceful_restartSSE(t *testing.T) {
+	server := NewServer()
+	server.HandleSSE("/events", func() <-chan int {
+		events := make(chan int, 1)
+		events <- 1
+		close(events)
+		return events
+	})
+	for i := 0; i < 2; i++ {
+		addr := freeAddr(t)
+		stop := make(chan struct{})
+		result := startGraceful(t, server, addr, stop)
+		response, err := http.Get("http://" + addr + "/events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if string(body) != "event: message\ndata: 1\n\n" {
+			t.Errorf("run %d: expected event, got %q", i+1, body)
+		}
+		close(stop)
+		if err := <-result; err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -15,8 +15,8 @@ Download, build and run example:
 
 Small?
 
-Yes, the framework consists of only three functions:
-HandleGET, HandlePOST, RunServer.
+Yes, the framework consists of only a handful of functions:
+HandleGET, HandlePOST, HandlePUT, HandlePATCH, HandleDELETE, RunServer.
 
 Evil?
 
@@ -46,13 +46,14 @@ and can't be interface{}.
 
 Now let's have some fun:
 
-HandleGET uses a handler function that returns a struct or string
-to create the GET response. Structs will be marshalled as JSON,
-strings will be used as body with auto-detected content type.
+HandleGET uses a handler function that returns a value or string
+to create the GET response. Structs, slices, maps, numbers and bools
+will be marshalled as JSON, strings will be used as body with
+auto-detected content type, and []byte as binary body.
 
 Format of GET handler:
 
-	func([url.Values]) ([struct|*struct|string][, error]) {}
+	func([url.Values|*struct]) ([value|string|[]byte][, error]) {}
 
 Example:
 
@@ -69,8 +70,8 @@ Example:
 		return "<!doctype html><p>Hello World"
 	})
 
-The GET handler function can optionally accept an url.Values argument
-and return an error as second result value that will be displayed as
+The GET handler function can optionally accept an url.Values
+or struct pointer argument filled from the query and return an error as second result value that will be displayed as
 500 internal server error if not nil.
 
 Example:
@@ -83,6 +84,139 @@ Example:
 		return "value = " + v, nil
 	})
 
+The response format of structs is negotiated by the Accept header
+of the request. JSON and XML are supported by default,
+other formats can be added with RegisterEncoder.
+JSON is preferred if the Accept header allows several formats
+with the same quality, and for browsers.
+Note that XML is marshalled with encoding/xml which ignores json tags,
+so fields hidden with json:"-" must also be tagged with xml:"-".
+
+Large responses can be streamed by returning an io.Reader or io.WriterTo,
+the Content-Type is detected from the first 512 bytes
+unless the result has a method ContentType() string.
+A receive channel result is streamed as JSON array, or as newline
+delimited JSON if the Accept header prefers application/x-ndjson,
+until the channel is closed or the client disconnects.
+The sender should not block forever if the client disconnects.
+
+Example:
+
+	rest.HandleGET("/export", func() <-chan *Record {
+		records := make(chan *Record)
+		go exportRecords(records)
+		return records
+	})
+
+Handlers can take arguments of type context.Context, *http.Request,
+http.Header and http.ResponseWriter at any position
+to access the request beyond the decoded arguments:
+
+	rest.HandleGET("/profile", func(ctx context.Context, header http.Header) (*Profile, error) {
+		return loadProfile(ctx, header.Get("Authorization"))
+	})
+
+HandleSSE streams the values of a channel as server-sent events
+until the client disconnects or the server is stopped:
+
+	rest.HandleSSE("/updates", func(ctx context.Context) <-chan *Update {
+		return subscribeUpdates(ctx)
+	})
+
+HandleWebSocket calls a handler for every JSON message received
+over a WebSocket connection and sends the result back.
+Values sent to an optional push channel argument are sent to the client:
+
+	rest.HandleWebSocket("/chat", func(push chan<- *Message, in *Message) (*Reply, error) {
+		return chatRoom.Post(in, push)
+	})
+
+Middleware of the form func(http.Handler) http.Handler can be added
+for all handlers with Use, or for some handlers with With.
+RequestRoute returns the registered route of a request to middleware:
+
+	rest.Use(logRequests)
+	rest.With(requireAuth).HandleDELETE("/users/{id:int}", deleteUser)
+
+Group returns a RouteGroup with the same Handle methods
+that prefixes the paths of its handlers and has its own middleware.
+Groups can be nested:
+
+	api := rest.Group("/api/v1")
+	api.Use(requireAuth)
+	api.HandleGET("/users/{id:int}", getUser)
+	api.Group("/admin").HandleDELETE("/users/{id:int}", deleteUser)
+
+HandleOpenAPI serves an OpenAPI 3 document describing all registered
+routes with schemas derived from the handler argument and result types:
+
+	rest.HandleOpenAPI("/openapi.json", "Users API", "1.0.0")
+
+Decoded struct arguments are validated by validate tags
+and an optional Validate method before the handler is called,
+violations result in a 422 response listing every invalid field:
+
+	type NewUser struct {
+		Name  string `json:"name" validate:"required,max=100"`
+		Email string `json:"email" validate:"required,email"`
+		Role  string `json:"role" validate:"oneof=admin user"`
+	}
+
+RunServerGraceful returns errors instead of panicking,
+drains in-flight requests when stopped and can stop on SIGINT and SIGTERM:
+
+	err := rest.RunServerGraceful(":8080", nil, rest.ShutdownOnSignals(), rest.DrainTimeout(10*time.Second))
+
+RunServerTLS serves HTTPS with HTTP/2, reloads changed certificate files
+and can verify client certificates that handlers read
+from a *tls.ConnectionState argument:
+
+	err := rest.RunServerTLS(":443", "cert.pem", "key.pem", nil, rest.ClientCertificates(clientCAs, true))
+
+Timeouts, header limits, keep-alives and the listener of
+RunServerGraceful and RunServerTLS are configured with options:
+
+	err := rest.RunServerGraceful("", nil,
+		rest.Listener(unixSocketListener),
+		rest.ReadTimeout(30*time.Second),
+		rest.MaxHeaderBytes(64<<10),
+	)
+
+File uploads of multipart/form-data requests are passed
+as struct fields of type *multipart.FileHeader, []*multipart.FileHeader,
+io.ReadCloser or []byte named like the file parts:
+
+	type Upload struct {
+		Title string                `form:"title"`
+		Image *multipart.FileHeader `form:"image" validate:"required"`
+	}
+
+Request bodies are limited to MaxBodySize, multipart/form-data
+bodies including files spilled to disk to MaxMultipartSize,
+and larger requests get a 413 payload too large response.
+Only MaxMultipartMemory bytes of uploaded files are held in memory.
+The limits can be overridden for routes with middleware:
+
+	rest.With(rest.BodyLimit(1<<30), rest.MultipartMemoryLimit(32<<20)).HandlePOST("/videos", uploadVideo)
+
+Request bodies are decoded by the media type of their Content-Type,
+so application/json; charset=utf-8 and suffixed types like
+application/vnd.api+json are decoded as JSON.
+Decoders for further media types can be registered:
+
+	rest.RegisterDecoder("application/yaml", yaml.Unmarshal)
+
+Errors created with NewHTTPError or helpers like NotFound and BadRequest
+set the status code of the error response:
+
+	rest.HandleGET("/users/{id:int}", func(id int) (*User, error) {
+		user, ok := users[id]
+		if !ok {
+			return nil, rest.NotFound("user %d not found", id)
+		}
+		return user, nil
+	})
+
 HandlePOST maps POST form data or a JSON document to a struct that is passed
 to the handler function. An error result from handler will be displayed
 as 500 internal server error message. An optional first string result
@@ -94,10 +228,11 @@ Suported content types for POST requests are:
 * text/plain
 * application/json
 * application/xml
+* media types registered with RegisterDecoder
 
 Format of POST handler:
 
-	func([*struct|url.Values]) ([struct|*struct|string],[error]) {}
+	func([*struct|url.Values]) ([value|string|[]byte][, error]) {}
 
 Example:
 
@@ -106,30 +241,65 @@ Example:
 		return err
 	})
 
-Both HandleGET and HandlePOST also accept one optional object argument.
+Paths can contain parameters of the format {name} or {name:type}
+where type is one of string, int, uint, float, uuid.
+Requests for paths that don't match the parameter types get a 404 response.
+If the first handler arguments are of string, integer or float kind,
+then they receive the path parameters in order,
+else the parameters are merged into the url.Values or struct argument.
+
+Example:
+
+	rest.HandleGET("/users/{id:int}/posts/{slug}", func(id int, slug string) *Post {
+		return findPost(id, slug)
+	})
+
+HandlePUT and HandlePATCH decode the request body like HandlePOST,
+HandleDELETE passes the URL query to the handler like HandleGET.
+
+All handler registration functions also accept one optional object argument.
 In that case handler is interpreted as a method of the type of object
 and called accordingly.
 
 Example:
 
 	rest.HandleGET("/method-call", (*myType).MethodName, myTypeObject)
+
+The package level functions register their handlers at DefaultServer
+which is served by RunServer. Requests for paths without a route
+at DefaultServer are passed to http.DefaultServeMux,
+so handlers registered with http.Handle keep working.
+Independent sets of handlers can be created with NewServer,
+every Server is a http.Handler and has
+the same HandleGET, HandlePOST, etc. methods.
+
+Example:
+
+	api := rest.NewServer()
+	api.HandleGET("/users/{id:int}", getUser)
+	api.HandlePOST("/users/{id:int}", updateUser)
+	http.Handle("/", api)
+
+HandleResource binds the methods List, Get, Create, Update and Delete
+of an object to GET, POST, PUT and DELETE requests of a resource path.
+
+Example:
+
+	rest.HandleResource("/users", &userStore)
 */
 package rest
 
 import (
-	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
-	"encoding/xml"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net"
 	"net/http"
 	"net/url"
-	"os"
 	"reflect"
-	"strconv"
-	"strings"
+	"runtime/debug"
 )
 
 var (
@@ -145,53 +315,68 @@ var (
 	// 405 error if not correct.
 	// Handy for testing POST handler via hand crafted GET requests.
 	DontCheckRequestMethod bool
+
+	// OnPanic is called with the request, the recovered value
+	// and the stack trace if a handler panics.
+	// The panic will be logged and a 500 internal server error
+	// response written regardless of OnPanic.
+	// Use it to report panics to an error tracker.
+	OnPanic func(request *http.Request, recovered interface{}, stack []byte)
 )
 
 /*
 HandleGET registers a HTTP GET handler for path.
-handler is a function with an optional url.Values argument.
-
-If the first result value of handler is a struct or struct pointer,
-then the struct will be marshalled as JSON response.
+handler is a function with an optional url.Values or struct pointer argument.
+
+If the argument is a struct pointer, then the query values will be set
+at the struct fields named by their form tag, json tag, or Go name.
+Nested structs and slice elements are addressed by keys
+like SubStruct.A or items[0].name, fields of embedded structs are promoted.
+Slice fields receive all values of repeated keys, pointer fields
+are only allocated if the key is present, and time.Time fields are
+parsed with the formats in TimeFormats.
+If a value can't be parsed as the field type, a 400 bad request
+response listing all invalid parameters will be sent.
+The struct is validated by its validate tags
+the same way as for HandlePOST.
+
+If the first result value of handler is a struct, slice, array, map,
+number, bool, a pointer to one of those, or implements json.Marshaler,
+then it will be marshalled as JSON response,
+or XML or any format registered with RegisterEncoder
+if requested by the Accept header of the request.
 If the first result value fo handler is a string,
 then it will be used as response body with an auto-detected content type.
-An optional second result value of type error will
+A []byte result will be used as application/octet-stream response body.
+An optional second result value of type error,
+or a single error result value, will
 create a 500 internal server error response if not nil.
+If the error is or wraps an HTTPError, then its status code will be used.
 All non error responses will use status code 200.
 
+path can contain parameters like /users/{id:int}
+that are passed as leading handler arguments
+or merged into the url.Values or struct argument.
+
+Arguments of type context.Context, *http.Request, http.Header,
+http.ResponseWriter and *tls.ConnectionState can be added at any position.
+They are not decoded but injected from the request,
+the context is cancelled when the client disconnects.
+The *tls.ConnectionState is nil for requests without TLS.
+A handler that writes to the http.ResponseWriter itself
+should not return a value besides an optional error.
+
 A single optional argument can be passed as object.
 In that case handler is interpreted as a method and
 object is the address of an object with such a method.
 
 Format of GET handler:
 
-	func([url.Values]) ([struct|*struct|string][, error]) {}
+	func([url.Values|*struct]) ([value|string|[]byte][, error]) {}
 
 */
 func HandleGET(path string, handler interface{}, object ...interface{}) {
-	handlerFunc, in, out := getHandlerFunc(handler, object)
-	httpHandler := &httpHandler{
-		method:      "GET",
-		handlerFunc: handlerFunc,
-	}
-	// Check handler arguments and install getter
-	switch len(in) {
-	case 0:
-		httpHandler.getArgs = func(request *http.Request) []reflect.Value {
-			return nil
-		}
-	case 1:
-		if in[0] != reflect.TypeOf(url.Values(nil)) {
-			panic(fmt.Errorf("HandleGET(): handler argument must be url.Values, got %s", in[0]))
-		}
-		httpHandler.getArgs = func(request *http.Request) []reflect.Value {
-			return []reflect.Value{reflect.ValueOf(request.URL.Query())}
-		}
-	default:
-		panic(fmt.Errorf("HandleGET(): handler accepts zero or one arguments, got %d", len(in)))
-	}
-	httpHandler.writeResult = writeResultFunc(out)
-	http.Handle(path, httpHandler)
+	DefaultServer.HandleGET(path, handler, object...)
 }
 
 /*
@@ -203,9 +388,15 @@ If the request content type is text/plain, then only a struct pointer
 is allowed as handler argument and the request body will be interpreted
 as JSON and unmarshalled to a new struct instance.
 
-If the request content type multipart/form-data, then only a struct pointer
-is allowed as handler argument and a file named JSON
-will be unmarshalled to a new struct instance.
+If the request content type is multipart/form-data, then only a struct pointer
+is allowed as handler argument. Text parts are set at the struct fields
+the same way as form values, file parts at fields with the same name
+of type *multipart.FileHeader, []*multipart.FileHeader for multiple files,
+io.ReadCloser for the opened file, or []byte for the file content.
+Opened files are closed and temporary files are removed
+after the handler has returned.
+A file or single value named JSON will be unmarshalled
+to a new struct instance if the struct has no JSON field.
 
 If the request content type is empty or application/x-www-form-urlencoded
 and the handler argument is of type url.Values, then the form
@@ -214,191 +405,247 @@ If the handler argument is a struct pointer and the form contains
 a single value named "JSON", then the value will be interpreted as
 JSON and unmarshalled to a new struct instance.
 If there are multiple form values, then they will be set at
-struct fields with exact matching names.
-
-If the first result value of handler is a struct or struct pointer,
-then the struct will be marshalled as JSON response.
+struct fields the same way as query values for HandleGET:
+Fields are named by their form tag, json tag, or Go name,
+and nested fields are addressed by keys like SubStruct.A or items[0].name
+
+If the request body can't be decoded, a 400 bad request response
+with a JSON body describing the error will be sent.
+Parameters of the Content-Type header are ignored, except a charset
+of text/plain and form requests which will be converted to UTF-8.
+Other content types are unmarshalled to a new struct instance with the
+decoder registered for them with RegisterDecoder, types with a structured
+syntax suffix like application/problem+json with the decoder of the suffix.
+Unsupported content types result in a 415 unsupported media type response.
+Request bodies larger than MaxBodySize, or MaxMultipartSize
+for multipart/form-data, are rejected with a 413 payload too large
+response. Use the BodyLimit middleware to override the limits for a route.
+
+Decoded struct arguments are validated before the handler is called.
+Struct fields can have a validate tag with comma separated rules:
+
+	required   the value must not be the zero value, nil or empty
+	min=N      numbers must be >= N, strings, slices and maps must have a length >= N
+	max=N      numbers must be <= N, strings, slices and maps must have a length <= N
+	email      the string must be an email address
+	oneof=a b  the value formatted as string must be one of the space separated values
+
+All rules except required are not checked for nil pointers,
+so use pointer fields for optional values.
+Fields of nested structs and slices of structs are validated too.
+If the argument implements Validator, then its Validate method
+is called after the tags have been checked.
+All violations are listed in a 422 unprocessable entity response.
+The fields are named by their json tag for JSON bodies,
+else like the keys of form values.
+Fields tagged with json:"-" or form:"-" are validated too.
+
+If the first result value of handler is a struct, slice, array, map,
+number, bool, a pointer to one of those, or implements json.Marshaler,
+then it will be marshalled as JSON response,
+or XML or any format registered with RegisterEncoder
+if requested by the Accept header of the request.
 If the first result value fo handler is a string,
 then it will be used as response body with an auto-detected content type.
-An optional second result value of type error will
+A []byte result will be used as application/octet-stream response body.
+An optional second result value of type error,
+or a single error result value, will
 create a 500 internal server error response if not nil.
+If the error is or wraps an HTTPError, then its status code will be used.
 All non error responses will use status code 200.
 
+path can contain parameters like /users/{id:int}
+that are passed as leading handler arguments
+or set at the struct fields with matching names.
+If the path parameters are passed as arguments, then the argument
+for the request body must follow them, a handler like
+func(id string) for a path with one parameter will panic.
+
+Arguments of type context.Context, *http.Request, http.Header,
+http.ResponseWriter and *tls.ConnectionState can be added at any position.
+They are not decoded but injected from the request,
+the context is cancelled when the client disconnects.
+The *tls.ConnectionState is nil for requests without TLS.
+A handler that writes to the http.ResponseWriter itself
+should not return a value besides an optional error.
+
 A single optional argument can be passed as object.
 In that case handler is interpreted as a method and
 object is the address of an object with such a method.
 
 Format of POST handler:
 
-	func([*struct|url.Values]) ([struct|*struct|string][, error]) {}
+	func([*struct|url.Values]) ([value|string|[]byte][, error]) {}
 
 */
 func HandlePOST(path string, handler interface{}, object ...interface{}) {
-	handlerFunc, in, out := getHandlerFunc(handler, object)
-	httpHandler := &httpHandler{
-		method:      "POST",
-		handlerFunc: handlerFunc,
-	}
-	// Check handler arguments and install getter
-	switch len(in) {
-	case 1:
-		a := in[0]
-		if a != urlValuesType && (a.Kind() != reflect.Ptr || a.Elem().Kind() != reflect.Struct) && a.Kind() != reflect.String {
-			panic(fmt.Errorf("HandlePOST(): first handler argument must be a struct pointer, string, or url.Values. Got %s", a))
-		}
-		httpHandler.getArgs = func(request *http.Request) []reflect.Value {
-			ct := request.Header.Get("Content-Type")
-			switch ct {
-			case "", "application/x-www-form-urlencoded":
-				request.ParseForm()
-				if a == urlValuesType {
-					return []reflect.Value{reflect.ValueOf(request.Form)}
-				}
-				s := reflect.New(a.Elem())
-				if len(request.Form) == 1 && request.Form.Get("JSON") != "" {
-					err := json.Unmarshal([]byte(request.Form.Get("JSON")), s.Interface())
-					if err != nil {
-						panic(err)
-					}
-				} else {
-					v := s.Elem()
-					for key, value := range request.Form {
-						if f := v.FieldByName(key); f.IsValid() && f.CanSet() {
-							switch f.Kind() {
-							case reflect.String:
-								f.SetString(value[0])
-							case reflect.Bool:
-								if val, err := strconv.ParseBool(value[0]); err == nil {
-									f.SetBool(val)
-								}
-							case reflect.Float32, reflect.Float64:
-								if val, err := strconv.ParseFloat(value[0], 64); err == nil {
-									f.SetFloat(val)
-								}
-							case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-								if val, err := strconv.ParseInt(value[0], 0, 64); err == nil {
-									f.SetInt(val)
-								}
-							case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-								if val, err := strconv.ParseUint(value[0], 0, 64); err == nil {
-									f.SetUint(val)
-								}
-							}
-						}
-					}
-				}
-				return []reflect.Value{s}
+	DefaultServer.HandlePOST(path, handler, object...)
+}
 
-			case "text/plain":
-				if a.Kind() != reflect.String {
-					panic(fmt.Errorf("HandlePOST(): first handler argument must be a string when request Content-Type is text/plain, got %s", a))
-				}
-				defer request.Body.Close()
-				body, err := ioutil.ReadAll(request.Body)
-				if err != nil {
-					panic(err)
-				}
-				return []reflect.Value{reflect.ValueOf(string(body))}
+/*
+HandlePUT registers a HTTP PUT handler for path.
+The request body is decoded the same way as for HandlePOST,
+see HandlePOST for the supported content types and handler formats.
 
-			case "application/xml":
-				if a.Kind() != reflect.Ptr || a.Elem().Kind() != reflect.Struct {
-					panic(fmt.Errorf("HandlePOST(): first handler argument must be a struct pointer when request Content-Type is application/xml, got %s", a))
-				}
-				s := reflect.New(a.Elem())
-				defer request.Body.Close()
-				body, err := ioutil.ReadAll(request.Body)
-				if err != nil {
-					panic(err)
-				}
-				err = xml.Unmarshal(body, s.Interface())
-				if err != nil {
-					panic(err)
-				}
-				return []reflect.Value{s}
+Format of PUT handler:
 
-			case "application/json":
-				if a.Kind() != reflect.Ptr || a.Elem().Kind() != reflect.Struct {
-					panic(fmt.Errorf("HandlePOST(): first handler argument must be a struct pointer when request Content-Type is application/json, got %s", a))
-				}
-				s := reflect.New(a.Elem())
-				defer request.Body.Close()
-				body, err := ioutil.ReadAll(request.Body)
-				if err != nil {
-					panic(err)
-				}
-				err = json.Unmarshal(body, s.Interface())
-				if err != nil {
-					panic(err)
-				}
-				return []reflect.Value{s}
+	func([*struct|url.Values]) ([value|string|[]byte][, error]) {}
 
-			case "multipart/form-data":
-				if a.Kind() != reflect.Ptr || a.Elem().Kind() != reflect.Struct {
-					panic(fmt.Errorf("HandlePOST(): first handler argument must be a struct pointer when request Content-Type is multipart/form-data, got %s", a))
-				}
-				file, _, err := request.FormFile("JSON")
-				if err != nil {
-					panic(err)
-				}
-				s := reflect.New(a.Elem())
-				defer file.Close()
-				body, err := ioutil.ReadAll(request.Body)
-				if err != nil {
-					panic(err)
-				}
-				err = json.Unmarshal(body, s.Interface())
-				if err != nil {
-					panic(err)
-				}
-				return []reflect.Value{s}
-			}
-			panic("Unsupported POST Content-Type: " + ct)
-		}
-	default:
-		panic(fmt.Errorf("HandlePOST(): handler accepts only one or thwo arguments, got %d", len(in)))
-	}
-	httpHandler.writeResult = writeResultFunc(out)
-	http.Handle(path, httpHandler)
+*/
+func HandlePUT(path string, handler interface{}, object ...interface{}) {
+	DefaultServer.HandlePUT(path, handler, object...)
+}
+
+/*
+HandlePATCH registers a HTTP PATCH handler for path.
+The request body is decoded the same way as for HandlePOST,
+see HandlePOST for the supported content types and handler formats.
+
+Format of PATCH handler:
+
+	func([*struct|url.Values]) ([value|string|[]byte][, error]) {}
+
+*/
+func HandlePATCH(path string, handler interface{}, object ...interface{}) {
+	DefaultServer.HandlePATCH(path, handler, object...)
+}
+
+/*
+HandleDELETE registers a HTTP DELETE handler for path.
+handler is a function with an optional url.Values or struct pointer
+argument that will be filled from the URL query, same as for HandleGET.
+The results of handler are written like for HandleGET.
+
+Format of DELETE handler:
+
+	func([url.Values|*struct]) ([value|string|[]byte][, error]) {}
+
+*/
+func HandleDELETE(path string, handler interface{}, object ...interface{}) {
+	DefaultServer.HandleDELETE(path, handler, object...)
 }
 
 /*
 RunServer starts an HTTP server with a given address
-with the registered GET and POST handlers.
+with the handlers registered at DefaultServer
+and at http.DefaultServeMux for paths without a DefaultServer route.
 If stop is non nil then a send on the channel
-will gracefully stop the server.
+will gracefully stop the server, in-flight requests
+have DefaultDrainTimeout to finish before RunServer returns.
+Like a plain http.Server, the server has no timeouts.
+RunServer panics if the server can't be started or fails,
+use RunServerGraceful to handle errors and to configure
+the timeouts and the shutdown.
 */
 func RunServer(addr string, stop chan struct{}) {
-	server := &http.Server{Addr: addr}
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		panic(err)
-	}
-	if stop != nil {
-		go func() {
-			<-stop
-			err := listener.Close()
-			if err != nil {
-				os.Stderr.WriteString(err.Error())
-			}
-			return
-		}()
+	DefaultServer.RunServer(addr, stop)
+}
+
+/*
+Server is a http.Handler with its own table of routes.
+It dispatches requests by path and request method,
+so the same path can be registered for different methods.
+
+The package level functions HandleGET, HandlePOST, etc.
+register their handlers at DefaultServer.
+Multiple independent servers can be used in the same process.
+The zero value of Server is ready to use.
+*/
+type Server struct {
+	router router
+}
+
+// NewServer returns a new Server without routes.
+func NewServer() *Server {
+	return &Server{}
+}
+
+// DefaultServer is the Server used by the package level functions.
+// Requests that don't match one of its routes are passed
+// to http.DefaultServeMux, so handlers registered with
+// http.Handle and http.HandleFunc are served too.
+var DefaultServer = &Server{router: router{fallback: http.DefaultServeMux}}
+
+// HandleGET registers a HTTP GET handler for path at server.
+// See the package function HandleGET for details.
+func (server *Server) HandleGET(path string, handler interface{}, object ...interface{}) {
+	server.handleWithQuery("GET", path, handler, object, nil)
+}
+
+// HandlePOST registers a HTTP POST handler for path at server.
+// See the package function HandlePOST for details.
+func (server *Server) HandlePOST(path string, handler interface{}, object ...interface{}) {
+	server.handleWithBody("POST", path, handler, object, nil)
+}
+
+// HandlePUT registers a HTTP PUT handler for path at server.
+// See the package function HandlePUT for details.
+func (server *Server) HandlePUT(path string, handler interface{}, object ...interface{}) {
+	server.handleWithBody("PUT", path, handler, object, nil)
+}
+
+// HandlePATCH registers a HTTP PATCH handler for path at server.
+// See the package function HandlePATCH for details.
+func (server *Server) HandlePATCH(path string, handler interface{}, object ...interface{}) {
+	server.handleWithBody("PATCH", path, handler, object, nil)
+}
+
+// HandleDELETE registers a HTTP DELETE handler for path at server.
+// See the package function HandleDELETE for details.
+func (server *Server) HandleDELETE(path string, handler interface{}, object ...interface{}) {
+	server.handleWithQuery("DELETE", path, handler, object, nil)
+}
+
+// ServeHTTP dispatches the request to the handler
+// registered for the request path and method.
+// Unknown paths result in a 404 error, unknown methods
+// for a known path in a 405 error.
+func (server *Server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	server.router.ServeHTTP(writer, request)
+}
+
+// RunServer starts an HTTP server with a given address
+// that serves the handlers registered at server.
+// See the package function RunServer for details.
+func (server *Server) RunServer(addr string, stop chan struct{}) {
+	err := server.RunServerGraceful(addr, stop, ReadHeaderTimeout(0), IdleTimeout(0))
+	if errors.Is(err, context.DeadlineExceeded) {
+		// Drain timeout expired, the server is stopped anyway
+		Log("ERROR:", err)
+		return
 	}
-	Log("Server listening at", addr)
-	err = server.Serve(listener)
-	// I know, that's a ugly and depending on undocumented behavior.
-	// But when the implementation changes, we'll see it immediately as panic.
-	// To the keepers of the Go standard libraries:
-	// It would be useful to return a documented error type
-	// when the network connection is closed.
-	if !strings.Contains(err.Error(), "use of closed network connection") {
+	if err != nil {
 		panic(err)
 	}
-	Log("Server stopped")
 }
 
 ///////////////////////////////////////////////////////////////////////////////
 // Internal stuff:
 
+// injectedArgs are the handler argument types that are not
+// decoded from the request but injected from the request itself.
+var injectedArgs = map[reflect.Type]func(http.ResponseWriter, *http.Request) reflect.Value{
+	contextType: func(writer http.ResponseWriter, request *http.Request) reflect.Value {
+		return reflect.ValueOf(request.Context())
+	},
+	requestType: func(writer http.ResponseWriter, request *http.Request) reflect.Value {
+		return reflect.ValueOf(request)
+	},
+	headerType: func(writer http.ResponseWriter, request *http.Request) reflect.Value {
+		return reflect.ValueOf(request.Header)
+	},
+	responseWriterType: func(writer http.ResponseWriter, request *http.Request) reflect.Value {
+		return reflect.ValueOf(writer)
+	},
+	tlsStateType: func(writer http.ResponseWriter, request *http.Request) reflect.Value {
+		return reflect.ValueOf(request.TLS)
+	},
+}
+
+// getHandlerFunc returns a function calling handler, or the method handler
+// of object, and its argument and result types.
+// Arguments of the types in injectedArgs are not part of in,
+// they are inserted at their position by f.
 func getHandlerFunc(handler interface{}, object []interface{}) (f reflectionFunc, in, out []reflect.Type) {
 	handlerValue := reflect.ValueOf(handler)
 	if handlerValue.Kind() != reflect.Func {
@@ -409,119 +656,338 @@ func getHandlerFunc(handler interface{}, object []interface{}) (f reflectionFunc
 	for i := 0; i < handlerType.NumOut(); i++ {
 		out[i] = handlerType.Out(i)
 	}
+	var objectValue reflect.Value
 	switch len(object) {
 	case 0:
-		f = func(args []reflect.Value) []reflect.Value {
-			return handlerValue.Call(args)
-		}
-		in = make([]reflect.Type, handlerType.NumIn())
-		for i := 0; i < handlerType.NumIn(); i++ {
-			in[i] = handlerType.In(i)
-		}
-		return f, in, out
 	case 1:
-		objectValue := reflect.ValueOf(object[0])
+		objectValue = reflect.ValueOf(object[0])
 		if objectValue.Kind() != reflect.Ptr {
 			panic(fmt.Errorf("object must be a pointer, got %T", objectValue.Interface()))
 		}
-		f = func(args []reflect.Value) []reflect.Value {
-			args = append([]reflect.Value{objectValue}, args...)
-			return handlerValue.Call(args)
+	default:
+		panic(fmt.Errorf("HandleGET(): only zero or one object allowed, got %d", len(object)))
+	}
+	first := len(object)
+	inject := make([]func(http.ResponseWriter, *http.Request) reflect.Value, handlerType.NumIn())
+	for i := first; i < handlerType.NumIn(); i++ {
+		if injectArg, ok := injectedArgs[handlerType.In(i)]; ok {
+			inject[i] = injectArg
+		} else {
+			in = append(in, handlerType.In(i))
+		}
+	}
+	f = func(writer http.ResponseWriter, request *http.Request, args []reflect.Value) []reflect.Value {
+		callArgs := make([]reflect.Value, handlerType.NumIn())
+		if first == 1 {
+			callArgs[0] = objectValue
+		}
+		for i := first; i < len(callArgs); i++ {
+			if inject[i] != nil {
+				callArgs[i] = inject[i](writer, request)
+			} else {
+				callArgs[i] = args[0]
+				args = args[1:]
+			}
 		}
-		in = make([]reflect.Type, handlerType.NumIn()-1)
-		for i := 1; i < handlerType.NumIn(); i++ {
-			in[i] = handlerType.In(i)
+		return handlerValue.Call(callArgs)
+	}
+	return f, in, out
+}
+
+// handleWithQuery registers a handler for a request method
+// whose arguments are taken from the URL query.
+func (server *Server) handleWithQuery(method, path string, handler interface{}, object []interface{}, middleware []func(http.Handler) http.Handler) {
+	template := parsePathTemplate(path)
+	handlerFunc, in, out := getHandlerFunc(handler, object)
+	info := &RouteInfo{Method: method, Path: path, Handler: handler, Args: in, Results: out}
+	server.add(info, template, &httpHandler{
+		getArgs:     validateArgsFunc(in, pathParamArgsFunc(method, template, in, queryArgsFunc)),
+		handlerFunc: handlerFunc,
+		writeResult: writeResultFunc(out),
+	}, middleware)
+}
+
+// handleWithBody registers a handler for a request method
+// whose argument is decoded from the request body.
+func (server *Server) handleWithBody(method, path string, handler interface{}, object []interface{}, middleware []func(http.Handler) http.Handler) {
+	template := parsePathTemplate(path)
+	handlerFunc, in, out := getHandlerFunc(handler, object)
+	// A trailing string argument would silently receive
+	// a path parameter instead of the text/plain body
+	if n := len(template.params); n > 0 && len(in) == n && in[n-1].Kind() == reflect.String {
+		panic(fmt.Errorf("Handle%s(): handler argument %d of type %s receives path parameter {%s} of %s, add an argument for the request body", method, n-1, in[n-1], template.params[n-1].param, path))
+	}
+	info := &RouteInfo{Method: method, Path: path, Handler: handler, Args: in, Results: out}
+	server.add(info, template, &httpHandler{
+		getArgs:     validateArgsFunc(in, pathParamArgsFunc(method, template, in, bodyArgsFunc)),
+		handlerFunc: handlerFunc,
+		writeResult: writeResultFunc(out),
+	}, middleware)
+}
+
+// queryArgsFunc checks the handler arguments in and returns
+// a function that creates the arguments from the URL query.
+func queryArgsFunc(method string, in []reflect.Type) getArgsFunc {
+	switch len(in) {
+	case 0:
+		return func(request *http.Request) ([]reflect.Value, error) {
+			return nil, nil
+		}
+	case 1:
+		a := in[0]
+		if a == urlValuesType {
+			return func(request *http.Request) ([]reflect.Value, error) {
+				return []reflect.Value{reflect.ValueOf(request.URL.Query())}, nil
+			}
+		}
+		if a.Kind() != reflect.Ptr || a.Elem().Kind() != reflect.Struct {
+			panic(fmt.Errorf("Handle%s(): handler argument must be url.Values or a struct pointer, got %s", method, a))
+		}
+		return func(request *http.Request) ([]reflect.Value, error) {
+			s := reflect.New(a.Elem())
+			if err := setStructFields(s.Elem(), request.URL.Query()); err != nil {
+				return nil, err
+			}
+			return []reflect.Value{s}, nil
+		}
+	}
+	panic(fmt.Errorf("Handle%s(): handler accepts zero or one arguments, got %d", method, len(in)))
+}
+
+// bodyArgsFunc checks the handler arguments in and returns
+// a function that decodes the arguments from the request body.
+func bodyArgsFunc(method string, in []reflect.Type) getArgsFunc {
+	switch len(in) {
+	case 1:
+		a := in[0]
+		if a != urlValuesType && (a.Kind() != reflect.Ptr || a.Elem().Kind() != reflect.Struct) && a.Kind() != reflect.String {
+			panic(fmt.Errorf("Handle%s(): first handler argument must be a struct pointer, string, or url.Values. Got %s", method, a))
+		}
+		isStructPtr := a.Kind() == reflect.Ptr && a.Elem().Kind() == reflect.Struct
+		return func(request *http.Request) ([]reflect.Value, error) {
+			if err := limitRequestBody(request); err != nil {
+				return nil, err
+			}
+			mediaType, params, err := parseContentType(request)
+			if err != nil {
+				return nil, err
+			}
+			switch mediaType {
+			case "", "application/x-www-form-urlencoded":
+				if a.Kind() == reflect.String {
+					return nil, unsupportedMediaType("expected Content-Type text/plain, got %q", mediaType)
+				}
+				if err := request.ParseForm(); err != nil {
+					return nil, badRequestError(err)
+				}
+				form, err := formToUTF8(request, params["charset"])
+				if err != nil {
+					return nil, err
+				}
+				if a == urlValuesType {
+					return []reflect.Value{reflect.ValueOf(form)}, nil
+				}
+				s := reflect.New(a.Elem())
+				if len(form) == 1 && form.Get("JSON") != "" {
+					data := []byte(form.Get("JSON"))
+					if err := json.Unmarshal(data, s.Interface()); err != nil {
+						return nil, decodeError(err, data)
+					}
+				} else if err := setStructFields(s.Elem(), form); err != nil {
+					return nil, badRequestError(err)
+				}
+				return []reflect.Value{s}, nil
+
+			case "text/plain":
+				if a.Kind() != reflect.String {
+					return nil, unsupportedMediaType("Content-Type text/plain is only supported for string arguments")
+				}
+				body, err := readBody(request, params["charset"])
+				if err != nil {
+					return nil, err
+				}
+				return []reflect.Value{reflect.ValueOf(string(body))}, nil
+
+			case "multipart/form-data":
+				if !isStructPtr {
+					return nil, unsupportedMediaType("Content-Type multipart/form-data is only supported for struct arguments")
+				}
+				if err := request.ParseMultipartForm(multipartMemory(request)); err != nil {
+					return nil, badRequestError(err)
+				}
+				s := reflect.New(a.Elem())
+				if err := setMultipartFields(s.Elem(), request.MultipartForm); err != nil {
+					return nil, badRequestError(err)
+				}
+				return []reflect.Value{s}, nil
+			}
+			if unmarshal, ok := lookupDecoder(mediaType); ok {
+				if !isStructPtr {
+					return nil, unsupportedMediaType("Content-Type %s is only supported for struct arguments", mediaType)
+				}
+				s := reflect.New(a.Elem())
+				if err := decodeBody(request, unmarshal, s.Interface()); err != nil {
+					return nil, err
+				}
+				return []reflect.Value{s}, nil
+			}
+			return nil, unsupportedMediaType("unsupported %s Content-Type %q", method, mediaType)
 		}
-		return f, in, out
 	}
-	panic(fmt.Errorf("HandleGET(): only zero or one object allowed, got %d", len(object)))
+	panic(fmt.Errorf("Handle%s(): handler accepts only one argument, got %d", method, len(in)))
 }
 
 var (
-	urlValuesType = reflect.TypeOf((*url.Values)(nil)).Elem()
-	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+	urlValuesType      = reflect.TypeOf((*url.Values)(nil)).Elem()
+	errorType          = reflect.TypeOf((*error)(nil)).Elem()
+	contextType        = reflect.TypeOf((*context.Context)(nil)).Elem()
+	requestType        = reflect.TypeOf((*http.Request)(nil))
+	headerType         = reflect.TypeOf((*http.Header)(nil)).Elem()
+	responseWriterType = reflect.TypeOf((*http.ResponseWriter)(nil)).Elem()
+	tlsStateType       = reflect.TypeOf((*tls.ConnectionState)(nil))
 )
 
-type reflectionFunc func([]reflect.Value) []reflect.Value
+// reflectionFunc calls a handler with args and the
+// injected arguments taken from writer and request.
+type reflectionFunc func(writer http.ResponseWriter, request *http.Request, args []reflect.Value) []reflect.Value
+
+// getArgsFunc creates the handler arguments from a request.
+type getArgsFunc func(*http.Request) ([]reflect.Value, error)
 
 type httpHandler struct {
-	method      string
-	getArgs     func(*http.Request) []reflect.Value
+	getArgs     getArgsFunc
 	handlerFunc reflectionFunc
-	writeResult func([]reflect.Value, http.ResponseWriter)
+	writeResult func([]reflect.Value, http.ResponseWriter, *http.Request)
 }
 
 func (handler *httpHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	Log(request.Method, request.URL)
-	if !DontCheckRequestMethod && request.Method != handler.method {
-		http.Error(writer, "405: Method Not Allowed", http.StatusMethodNotAllowed)
+	defer recoverPanic(writer, request)
+	args, err := handler.getArgs(request)
+	if request.MultipartForm != nil {
+		defer cleanupMultipart(request.MultipartForm, args)
+	}
+	if err != nil {
+		writeError(writer, badRequestError(err))
 		return
 	}
-	result := handler.handlerFunc(handler.getArgs(request))
-	handler.writeResult(result, writer)
+	result := handler.handlerFunc(writer, request, args)
+	handler.writeResult(result, writer, request)
 }
 
-func writeError(writer http.ResponseWriter, err error) {
-	Log("ERROR:", err)
-	http.Error(writer, err.Error(), http.StatusInternalServerError)
+// recoverPanic recovers from a panic of a handler,
+// logs it with the stack trace and writes a 500 response.
+// It has to be called deferred.
+func recoverPanic(writer http.ResponseWriter, request *http.Request) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if recovered == http.ErrAbortHandler {
+		panic(recovered)
+	}
+	stack := debug.Stack()
+	Log("PANIC:", request.Method, request.URL, recovered, "\n"+string(stack))
+	if OnPanic != nil {
+		OnPanic(request, recovered, stack)
+	}
+	// Don't expose details of the panic to the client
+	writeError(writer, errors.New("panic in handler"))
 }
 
-func writeResultFunc(out []reflect.Type) func([]reflect.Value, http.ResponseWriter) {
-	var returnError func(result []reflect.Value, writer http.ResponseWriter) bool
+func writeResultFunc(out []reflect.Type) func([]reflect.Value, http.ResponseWriter, *http.Request) {
 	switch len(out) {
-	case 2:
-		if out[1] == errorType {
-			returnError = func(result []reflect.Value, writer http.ResponseWriter) (isError bool) {
-				if isError = !result[1].IsNil(); isError {
-					writeError(writer, result[1].Interface().(error))
-				}
-				return isError
-			}
-		} else {
-			panic(fmt.Errorf("HandleGET(): second result value of handle must be of type error, got %s", out[1]))
+	case 0:
+		return func(result []reflect.Value, writer http.ResponseWriter, request *http.Request) {
+			// do nothing, status code 200 will be returned
 		}
-		fallthrough
 	case 1:
-		r := out[0]
-		if r.Kind() == reflect.Struct || (r.Kind() == reflect.Ptr && r.Elem().Kind() == reflect.Struct) {
-			return func(result []reflect.Value, writer http.ResponseWriter) {
-				if returnError != nil && returnError(result, writer) {
-					return
-				}
-				j, err := json.Marshal(result[0].Interface())
-				if err != nil {
-					writeError(writer, err)
-					return
-				}
-				if IndentJSON != "" {
-					var buf bytes.Buffer
-					err = json.Indent(&buf, j, "", IndentJSON)
-					if err != nil {
-						writeError(writer, err)
-						return
-					}
-					j = buf.Bytes()
-				}
-				writer.Header().Set("Content-Type", "application/json")
-				writer.Write(j)
-			}
-		} else if r.Kind() == reflect.String {
-			return func(result []reflect.Value, writer http.ResponseWriter) {
-				if returnError != nil && returnError(result, writer) {
-					return
+		if out[0] == errorType {
+			return func(result []reflect.Value, writer http.ResponseWriter, request *http.Request) {
+				if !result[0].IsNil() {
+					writeError(writer, result[0].Interface().(error))
 				}
-				bytes := []byte(result[0].String())
-				ct := http.DetectContentType(bytes)
-				writer.Header().Set("Content-Type", ct)
-				writer.Write(bytes)
 			}
-		} else {
-			panic(fmt.Errorf("first result value of handler must be of type string or struct(pointer), got %s", r))
 		}
-	case 0:
-		return func(result []reflect.Value, writer http.ResponseWriter) {
-			// do nothing, status code 200 will be returned
+	case 2:
+		if out[1] != errorType {
+			panic(fmt.Errorf("second result value of handler must be of type error, got %s", out[1]))
+		}
+	default:
+		panic(fmt.Errorf("zero to two return values allowed, got %d", len(out)))
+	}
+	writeValue := valueWriterFunc(out[0])
+	return func(result []reflect.Value, writer http.ResponseWriter, request *http.Request) {
+		if len(result) == 2 && !result[1].IsNil() {
+			writeError(writer, result[1].Interface().(error))
+			return
+		}
+		writeValue(result[0], writer, request)
+	}
+}
+
+// valueWriterFunc returns a function that writes
+// a handler result value of type t as response.
+//
+// io.Reader, io.WriterTo and channels are streamed with streamWriterFunc,
+// []byte is written as application/octet-stream,
+// strings as body with auto-detected content type.
+// Types implementing json.Marshaler, structs, slices, arrays,
+// maps, numbers and bools are written with writeEncoded.
+func valueWriterFunc(t reflect.Type) func(reflect.Value, http.ResponseWriter, *http.Request) {
+	if writeStream := streamWriterFunc(t); writeStream != nil {
+		return writeStream
+	}
+	switch {
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 && !isJSONMarshaler(t):
+		return func(v reflect.Value, writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "application/octet-stream")
+			writer.Write(v.Bytes())
+		}
+
+	case t.Kind() == reflect.String && !isJSONMarshaler(t):
+		return func(v reflect.Value, writer http.ResponseWriter, request *http.Request) {
+			bytes := []byte(v.String())
+			ct := http.DetectContentType(bytes)
+			writer.Header().Set("Content-Type", ct)
+			writer.Write(bytes)
+		}
+
+	case isEncodable(t):
+		return func(v reflect.Value, writer http.ResponseWriter, request *http.Request) {
+			writeEncoded(writer, request, v.Interface())
+		}
+	}
+	panic(fmt.Errorf("first result value of handler must be a string, []byte, or marshallable as JSON, got %s", t))
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func isJSONMarshaler(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType)
+}
+
+// isEncodable returns if values of type t can be marshalled as JSON.
+// Interface types other than json.Marshaler are not allowed,
+// because handler results must be statically typed.
+func isEncodable(t reflect.Type) bool {
+	if isJSONMarshaler(t) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return isEncodable(t.Elem()) || t.Elem().Kind() == reflect.Interface
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return isEncodable(t.Elem()) || t.Elem().Kind() == reflect.Interface
 		}
 	}
-	panic(fmt.Errorf("zero to two return values allowed, got %d", len(out)))
+	return false
 }
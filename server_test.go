@@ -1,48 +1,25 @@
+//go:build !goci
 // +build !goci
+
 package rest
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 const ServerAddr = "0.0.0.0:8080"
 
 var closeChan = make(chan struct{})
 
-type MyIntType int
-
-type Struct struct {
-	Bool      bool
-	Int       int
-	Uint      uint
-	Ignore    int `json:"-"`
-	Float32   float32
-	Float64   float64
-	String    string
-	SubStruct SubStruct
-}
-
-type SubStruct struct {
-	A MyIntType
-	B MyIntType
-}
-
-func NewStruct() *Struct {
-	return &Struct{
-		Bool:    true,
-		Int:     1,
-		Uint:    2,
-		Ignore:  3,
-		Float32: 4,
-		Float64: 5,
-		String:  "7",
-		SubStruct: SubStruct{
-			A: 8,
-			B: 9,
-		},
-	}
-}
-
 var RefStruct = Struct{
 	Bool:    true,
 	Int:     1,
@@ -59,6 +36,38 @@ var RefStruct = Struct{
 
 func TestStartServer(t *testing.T) {
 	go RunServer(ServerAddr, closeChan)
+	// Wait until the server accepts connections
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", ServerAddr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server did not start")
+}
+
+// doRequest sends a request with method and body to path
+// and returns the status code and response body.
+func doRequest(t *testing.T, method, path, contentType, body string) (int, string) {
+	request, err := http.NewRequest(method, "http://"+ServerAddr+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, string(data)
 }
 
 func TestHandleGET_struct(t *testing.T) {
@@ -105,6 +114,152 @@ func TestHandleGET_struct_error(t *testing.T) {
 	// }
 }
 
+func TestHandlePUT_json(t *testing.T) {
+	path := "/put/struct.json"
+	HandlePUT(path, func(in *Struct) *Struct {
+		return in
+	})
+	status, body := doRequest(t, "PUT", path, "application/json", `{"Int":42,"String":"put"}`)
+	if status != http.StatusOK || !strings.Contains(body, `"Int":42`) || !strings.Contains(body, `"String":"put"`) {
+		t.Errorf("PUT %s: invalid result %d %s", path, status, body)
+	}
+	status, _ = doRequest(t, "POST", path, "application/json", `{}`)
+	if status != http.StatusMethodNotAllowed {
+		t.Errorf("POST %s: expected status 405, got %d", path, status)
+	}
+}
+
+func TestHandlePATCH_form(t *testing.T) {
+	path := "/patch/struct.json"
+	HandlePATCH(path, func(in *Struct) *Struct {
+		return in
+	})
+	status, body := doRequest(t, "PATCH", path, "application/x-www-form-urlencoded", "Int=7&Bool=true")
+	if status != http.StatusOK || !strings.Contains(body, `"Int":7`) || !strings.Contains(body, `"Bool":true`) {
+		t.Errorf("PATCH %s: invalid result %d %s", path, status, body)
+	}
+}
+
+func TestHandleDELETE(t *testing.T) {
+	path := "/delete"
+	HandleDELETE(path, func(params url.Values) string {
+		return "deleted " + params.Get("id")
+	})
+	status, body := doRequest(t, "DELETE", path+"?id=5", "", "")
+	if status != http.StatusOK || body != "deleted 5" {
+		t.Errorf("DELETE %s: invalid result %d %s", path, status, body)
+	}
+}
+
+func TestHandleGET_pathParams(t *testing.T) {
+	HandleGET("/users/{id:int}/posts/{slug}", func(id int, slug string, params url.Values) string {
+		return fmt.Sprintf("%d %s %s", id, slug, params.Get("q"))
+	})
+	status, body := doRequest(t, "GET", "/users/42/posts/hello?q=x", "", "")
+	if status != http.StatusOK || body != "42 hello x" {
+		t.Errorf("GET /users/42/posts/hello: invalid result %d %s", status, body)
+	}
+	status, _ = doRequest(t, "GET", "/users/abc/posts/hello", "", "")
+	if status != http.StatusNotFound {
+		t.Errorf("GET /users/abc/posts/hello: expected status 404, got %d", status)
+	}
+
+	HandleGET("/users/{id:int}/values", func(params url.Values) string {
+		return params.Get("id")
+	})
+	status, body = doRequest(t, "GET", "/users/7/values", "", "")
+	if status != http.StatusOK || body != "7" {
+		t.Errorf("GET /users/7/values: invalid result %d %s", status, body)
+	}
+}
+
+func TestHandlePUT_pathParamsStruct(t *testing.T) {
+	HandlePUT("/put/{String}/struct.json", func(in *Struct) *Struct {
+		return in
+	})
+	status, body := doRequest(t, "PUT", "/put/fromPath/struct.json", "application/json", `{"Int":1,"String":"fromBody"}`)
+	if status != http.StatusOK || !strings.Contains(body, `"String":"fromPath"`) {
+		t.Errorf("PUT /put/fromPath/struct.json: invalid result %d %s", status, body)
+	}
+}
+
+func TestHandleGET_injectedArgs(t *testing.T) {
+	HandleGET("/injected/{id:int}", func(ctx context.Context, id int, request *http.Request, params url.Values, writer http.ResponseWriter) string {
+		writer.Header().Set("X-Injected", "yes")
+		return fmt.Sprintf("%d %s %s %v", id, params.Get("q"), request.URL.Path, ctx.Err())
+	})
+	status, body := doRequest(t, "GET", "/injected/5?q=x", "", "")
+	if status != http.StatusOK || body != "5 x /injected/5 <nil>" {
+		t.Errorf("GET /injected/5: invalid result %d %s", status, body)
+	}
+}
+
+func TestHandlePOST_injectedArgs(t *testing.T) {
+	HandlePOST("/injected.json", func(header http.Header, in *Struct, ctx context.Context) string {
+		return header.Get("Content-Type") + " " + in.String
+	})
+	status, body := doRequest(t, "POST", "/injected.json", "application/json", `{"String":"hello"}`)
+	if status != http.StatusOK || body != "application/json hello" {
+		t.Errorf("POST /injected.json: invalid result %d %s", status, body)
+	}
+}
+
+type structStore struct {
+	structs map[string]*Struct
+}
+
+func (store *structStore) List() string {
+	return fmt.Sprintf("%d structs", len(store.structs))
+}
+
+func (store *structStore) Get(id string) (*Struct, error) {
+	s, ok := store.structs[id]
+	if !ok {
+		return nil, errors.New("not found: " + id)
+	}
+	return s, nil
+}
+
+func (store *structStore) Update(id string, in *Struct) *Struct {
+	store.structs[id] = in
+	return in
+}
+
+func (store *structStore) Delete(id string) string {
+	delete(store.structs, id)
+	return "deleted " + id
+}
+
+func TestHandleResource(t *testing.T) {
+	store := &structStore{structs: map[string]*Struct{"a": NewStruct()}}
+	HandleResource("/structs", store)
+
+	var result Struct
+	err := GetJSONStrict("http://"+ServerAddr+"/structs/a", &result)
+	if err != nil {
+		t.Error(err)
+	}
+	if result != RefStruct {
+		t.Errorf("GET /structs/a: invalid result")
+	}
+	status, _ := doRequest(t, "PUT", "/structs/b", "application/json", `{"Int":3}`)
+	if status != http.StatusOK || store.structs["b"] == nil || store.structs["b"].Int != 3 {
+		t.Errorf("PUT /structs/b: invalid result %d", status)
+	}
+	status, body := doRequest(t, "DELETE", "/structs/a", "", "")
+	if status != http.StatusOK || body != "deleted a" || store.structs["a"] != nil {
+		t.Errorf("DELETE /structs/a: invalid result %d %s", status, body)
+	}
+	status, _ = doRequest(t, "POST", "/structs", "application/json", `{}`)
+	if status != http.StatusMethodNotAllowed {
+		t.Errorf("POST /structs: expected status 405, got %d", status)
+	}
+	status, _ = doRequest(t, "GET", "/structs/a/b", "", "")
+	if status != http.StatusNotFound {
+		t.Errorf("GET /structs/a/b: expected status 404, got %d", status)
+	}
+}
+
 // TODO: needs much more testing, but see example for some working code
 
 func TestStopServer(t *testing.T) {
@@ -0,0 +1,217 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SSEHeartbeatInterval is the interval in which a comment line
+// is sent to keep idle server-sent event connections alive.
+// Zero disables heartbeats.
+var SSEHeartbeatInterval = 15 * time.Second
+
+/*
+Event can be sent over the channel of a HandleSSE handler
+to set the name and id of the server-sent event.
+Data will be marshalled as JSON.
+Values of other types are sent as events with the name "message"
+and without id.
+*/
+type Event struct {
+	ID   string
+	Name string
+	Data interface{}
+}
+
+var eventType = reflect.TypeOf(Event{})
+
+type lastEventIDKey struct{}
+
+// LastEventID returns the value of the Last-Event-ID header
+// of a reconnecting server-sent events client
+// from the context passed to a HandleSSE handler.
+func LastEventID(ctx context.Context) string {
+	id, _ := ctx.Value(lastEventIDKey{}).(string)
+	return id
+}
+
+/*
+HandleSSE registers a HTTP GET handler for path
+that streams server-sent events.
+
+handler takes an optional context.Context as first argument,
+followed by the arguments of a HandleGET handler,
+and returns a receive channel and an optional error.
+Every value received from the channel will be marshalled as JSON
+and sent as data of an event frame. Send Event values to set
+the name and id of the events.
+
+The context is cancelled when the client disconnects
+or the server is stopped, the handler should then stop
+sending and close the channel.
+The Last-Event-ID header of reconnecting clients
+is available via LastEventID(ctx).
+
+Middleware that wraps the http.ResponseWriter must implement
+Unwrap() http.ResponseWriter so that events can be flushed,
+else the request fails with a 500 internal server error.
+
+Format of SSE handler:
+
+	func([context.Context, ][url.Values|*struct]) (<-chan T[, error]) {}
+
+Example:
+
+	rest.HandleSSE("/updates", func(ctx context.Context) <-chan *Update {
+		updates := make(chan *Update)
+		go func() {
+			defer close(updates)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case u := <-allUpdates:
+					updates <- u
+				}
+			}
+		}()
+		return updates
+	})
+*/
+func HandleSSE(path string, handler interface{}, object ...interface{}) {
+	DefaultServer.HandleSSE(path, handler, object...)
+}
+
+// HandleSSE registers a server-sent events handler for path at server.
+// See the package function HandleSSE for details.
+func (server *Server) HandleSSE(path string, handler interface{}, object ...interface{}) {
+	server.handleSSE(path, handler, object, nil)
+}
+
+func (server *Server) handleSSE(path string, handler interface{}, object []interface{}, middleware []func(http.Handler) http.Handler) {
+	template := parsePathTemplate(path)
+	handlerFunc, in, out := getHandlerFunc(handler, object)
+	if len(out) == 0 || len(out) > 2 || out[0].Kind() != reflect.Chan || out[0].ChanDir()&reflect.RecvDir == 0 {
+		panic(fmt.Errorf("HandleSSE(): handler must return a receive channel and an optional error, got %v", out))
+	}
+	if len(out) == 2 && out[1] != errorType {
+		panic(fmt.Errorf("HandleSSE(): second result value of handler must be of type error, got %s", out[1]))
+	}
+	if elem := out[0].Elem(); elem != eventType && !isEncodable(elem) {
+		panic(fmt.Errorf("HandleSSE(): channel elements must be marshallable as JSON, got %s", elem))
+	}
+	info := &RouteInfo{Method: "GET", Path: path, Handler: handler, Args: in, Results: out, protocol: "sse"}
+	server.add(info, template, &sseHandler{
+		getArgs:     validateArgsFunc(in, pathParamArgsFunc("GET", template, in, queryArgsFunc)),
+		handlerFunc: handlerFunc,
+	}, middleware)
+}
+
+type sseHandler struct {
+	getArgs     getArgsFunc
+	handlerFunc reflectionFunc
+}
+
+func (handler *sseHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	defer recoverPanic(writer, request)
+
+	if !canFlush(writer) {
+		writeError(writer, fmt.Errorf("streaming not supported by %T", writer))
+		return
+	}
+	flusher := http.NewResponseController(writer)
+	args, err := handler.getArgs(request)
+	if err != nil {
+		writeError(writer, badRequestError(err))
+		return
+	}
+	ctx, cancel := context.WithCancel(request.Context())
+	defer cancel()
+	if id := request.Header.Get("Last-Event-ID"); id != "" {
+		ctx = context.WithValue(ctx, lastEventIDKey{}, id)
+	}
+	result := handler.handlerFunc(writer, request.WithContext(ctx), args)
+	if len(result) == 2 && !result[1].IsNil() {
+		writeError(writer, result[1].Interface().(error))
+		return
+	}
+
+	header := writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no") // disable proxy buffering
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	if result[0].IsNil() {
+		return
+	}
+
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: result[0]},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(shutdownChan(request))},
+	}
+	if SSEHeartbeatInterval > 0 {
+		heartbeat := time.NewTicker(SSEHeartbeatInterval)
+		defer heartbeat.Stop()
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(heartbeat.C)})
+	}
+	for {
+		chosen, value, ok := reflect.Select(cases)
+		switch chosen {
+		case 0:
+			if !ok {
+				return // channel closed
+			}
+			if err := writeEvent(writer, value.Interface()); err != nil {
+				Log("ERROR:", err)
+				return
+			}
+		case 1, 2:
+			return // client disconnected or server stopped
+		case 3:
+			if _, err := writer.Write([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// sseLineReplacer removes line breaks from single line fields
+var sseLineReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+// writeEvent writes value as server-sent event frame.
+// The data is marshalled with marshalJSON and split
+// into multiple data lines if it contains newlines.
+func writeEvent(writer http.ResponseWriter, value interface{}) error {
+	event, ok := value.(Event)
+	if !ok {
+		event = Event{Data: value}
+	}
+	if event.Name == "" {
+		event.Name = "message"
+	}
+	data, err := marshalJSON(event.Data)
+	if err != nil {
+		return err
+	}
+	var frame bytes.Buffer
+	fmt.Fprintf(&frame, "event: %s\n", sseLineReplacer.Replace(event.Name))
+	if event.ID != "" {
+		fmt.Fprintf(&frame, "id: %s\n", sseLineReplacer.Replace(event.ID))
+	}
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		frame.WriteString("data: ")
+		frame.Write(line)
+		frame.WriteByte('\n')
+	}
+	frame.WriteByte('\n')
+	_, err = writer.Write(frame.Bytes())
+	return err
+}
@@ -0,0 +1,111 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHandleSSE(t *testing.T) {
+	server := NewServer()
+	server.HandleSSE("/events/{topic}", func(ctx context.Context, params url.Values) <-chan Event {
+		events := make(chan Event)
+		go func() {
+			defer close(events)
+			events <- Event{ID: "1", Name: params.Get("topic"), Data: LastEventID(ctx)}
+			events <- Event{ID: "2", Data: &SubStruct{A: 1}}
+		}()
+		return events
+	})
+
+	request := httptest.NewRequest("GET", "/events/news", nil)
+	request.Header.Set("Last-Event-ID", "0")
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	expected := "event: news\nid: 1\ndata: \"0\"\n\nevent: message\nid: 2\ndata: {\"A\":1,\"B\":0}\n\n"
+	if response.Header().Get("Content-Type") != "text/event-stream" || response.Body.String() != expected {
+		t.Errorf("invalid response %s %q", response.Header().Get("Content-Type"), response.Body)
+	}
+}
+
+// unwrappingWriter wraps a http.ResponseWriter
+// like logging middleware does.
+type unwrappingWriter struct {
+	http.ResponseWriter
+}
+
+func (w *unwrappingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestHandleSSE_wrappedWriter(t *testing.T) {
+	server := NewServer()
+	server.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			next.ServeHTTP(&unwrappingWriter{writer}, request)
+		})
+	})
+	server.HandleSSE("/events", func() <-chan int {
+		events := make(chan int, 1)
+		events <- 1
+		close(events)
+		return events
+	})
+	server.HandleGET("/stream", func() <-chan int {
+		values := make(chan int, 1)
+		values <- 1
+		close(values)
+		return values
+	})
+
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, httptest.NewRequest("GET", "/events", nil))
+	if response.Code != http.StatusOK || response.Body.String() != "event: message\ndata: 1\n\n" || !response.Flushed {
+		t.Errorf("SSE through wrapped writer: invalid response %d %q", response.Code, response.Body)
+	}
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, httptest.NewRequest("GET", "/stream", nil))
+	if response.Body.String() != "[1]" || !response.Flushed {
+		t.Errorf("stream through wrapped writer: invalid response %q flushed=%v", response.Body, response.Flushed)
+	}
+}
+
+func TestHandleSSE_shutdown(t *testing.T) {
+	server := NewServer()
+	stopped := make(chan struct{})
+	server.HandleSSE("/events", func(ctx context.Context) <-chan int {
+		go func() {
+			<-ctx.Done()
+			close(stopped)
+		}()
+		return make(chan int)
+	})
+	shutdown := make(chan struct{})
+	request := httptest.NewRequest("GET", "/events", nil)
+	request = request.WithContext(context.WithValue(request.Context(), shutdownKey{}, (<-chan struct{})(shutdown)))
+	done := make(chan struct{})
+	go func() {
+		server.ServeHTTP(httptest.NewRecorder(), request)
+		close(done)
+	}()
+	close(shutdown)
+	for _, c := range []chan struct{}{done, stopped} {
+		select {
+		case <-c:
+		case <-time.After(time.Second):
+			t.Fatal("SSE handler not stopped by server shutdown")
+		}
+	}
+}
+
+func TestHandleSSE_invalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("handler without channel result must panic")
+		}
+	}()
+	NewServer().HandleSSE("/events", func() string { return "" })
+}
@@ -0,0 +1,170 @@
+package rest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+var (
+	readerType   = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	writerToType = reflect.TypeOf((*io.WriterTo)(nil)).Elem()
+)
+
+// contentTyper can be implemented by io.Reader and io.WriterTo
+// handler results to set the Content-Type of the response
+// instead of detecting it from the first 512 bytes.
+type contentTyper interface {
+	ContentType() string
+}
+
+// streamMediaTypes are the media types offered for channel results.
+var streamMediaTypes = []string{"application/json", "application/x-ndjson"}
+
+// streamWriterFunc returns a function that streams a handler
+// result of type t as response, or nil if t is not a
+// io.Reader, io.WriterTo or receivable channel.
+// Readers and WriterTos that implement io.Closer are closed
+// after writing.
+func streamWriterFunc(t reflect.Type) func(reflect.Value, http.ResponseWriter, *http.Request) {
+	switch {
+	case t.Implements(readerType):
+		return func(v reflect.Value, writer http.ResponseWriter, request *http.Request) {
+			if isNil(v) {
+				return
+			}
+			writeReader(writer, v.Interface().(io.Reader))
+		}
+
+	case t.Implements(writerToType):
+		return func(v reflect.Value, writer http.ResponseWriter, request *http.Request) {
+			if isNil(v) {
+				return
+			}
+			writerTo := v.Interface().(io.WriterTo)
+			if closer, ok := writerTo.(io.Closer); ok {
+				defer closer.Close()
+			}
+			if typer, ok := writerTo.(contentTyper); ok {
+				writer.Header().Set("Content-Type", typer.ContentType())
+			}
+			// Without Content-Type, http.ResponseWriter detects it
+			// from the first write
+			if _, err := writerTo.WriteTo(writer); err != nil {
+				Log("ERROR:", err)
+			}
+		}
+
+	case t.Kind() == reflect.Chan:
+		if t.ChanDir()&reflect.RecvDir == 0 {
+			panic(fmt.Errorf("channel result value of handler must be receivable, got %s", t))
+		}
+		if !isEncodable(t.Elem()) {
+			panic(fmt.Errorf("channel result value of handler must have elements marshallable as JSON, got %s", t))
+		}
+		return writeChan
+	}
+	return nil
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Chan, reflect.Map, reflect.Slice, reflect.Func:
+		return v.IsNil()
+	}
+	return false
+}
+
+// writeReader copies reader to writer and sets the Content-Type
+// from the first 512 bytes if reader doesn't implement contentTyper.
+func writeReader(writer http.ResponseWriter, reader io.Reader) {
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if typer, ok := reader.(contentTyper); ok {
+		writer.Header().Set("Content-Type", typer.ContentType())
+	} else {
+		buffered := bufio.NewReaderSize(reader, 512)
+		head, _ := buffered.Peek(512)
+		writer.Header().Set("Content-Type", http.DetectContentType(head))
+		reader = buffered
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		Log("ERROR:", err)
+	}
+}
+
+// writeChan streams the elements of the channel v
+// as JSON array, or as newline delimited JSON if
+// application/x-ndjson is preferred by the Accept header.
+// The response is flushed after every element.
+// Streaming ends when the channel is closed
+// or the client closes the connection.
+func writeChan(v reflect.Value, writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Add("Vary", "Accept")
+	offer := negotiate(request, streamMediaTypes)
+	if offer == -1 {
+		writeError(writer, NewHTTPError(http.StatusNotAcceptable, "no acceptable media type for %q, available are %s", request.Header.Get("Accept"), strings.Join(streamMediaTypes, ", ")))
+		return
+	}
+	ndjson := streamMediaTypes[offer] == "application/x-ndjson"
+	writer.Header().Set("Content-Type", streamMediaTypes[offer])
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	flusher := http.NewResponseController(writer)
+	if !ndjson {
+		writer.Write([]byte{'['})
+	}
+	if !v.IsNil() {
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: v},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(request.Context().Done())},
+		}
+		for i := 0; ; i++ {
+			chosen, elem, ok := reflect.Select(cases)
+			if chosen == 1 {
+				return // client gone
+			}
+			if !ok {
+				break // channel closed
+			}
+			data, err := json.Marshal(elem.Interface())
+			if err != nil {
+				// Stop with invalid JSON so that the client notices the error
+				Log("ERROR:", err)
+				return
+			}
+			switch {
+			case ndjson:
+				data = append(data, '\n')
+			case i > 0:
+				writer.Write([]byte{','})
+			}
+			writer.Write(data)
+			flusher.Flush()
+		}
+	}
+	if !ndjson {
+		writer.Write([]byte{']'})
+	}
+}
+
+// canFlush returns if writer or one of the writers
+// it wraps with an Unwrap() http.ResponseWriter method
+// implements http.Flusher, so that the response
+// can be flushed with an http.ResponseController.
+func canFlush(writer http.ResponseWriter) bool {
+	for {
+		switch w := writer.(type) {
+		case http.Flusher:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			writer = w.Unwrap()
+		default:
+			return false
+		}
+	}
+}
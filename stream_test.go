@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type closingReader struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closingReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestStreamResults(t *testing.T) {
+	reader := &closingReader{Reader: strings.NewReader("<!doctype html><p>Hello")}
+	server := NewServer()
+	server.HandleGET("/reader", func() io.Reader { return reader })
+	server.HandleGET("/buffer", func() *bytes.Buffer { return bytes.NewBufferString("plain text") })
+	server.HandleGET("/chan", func() <-chan SubStruct {
+		c := make(chan SubStruct)
+		go func() {
+			for i := 0; i < 3; i++ {
+				c <- SubStruct{A: MyIntType(i)}
+			}
+			close(c)
+		}()
+		return c
+	})
+
+	for _, c := range []struct {
+		path, accept, contentType, body string
+	}{
+		{"/reader", "", "text/html; charset=utf-8", "<!doctype html><p>Hello"},
+		{"/buffer", "", "text/plain; charset=utf-8", "plain text"},
+		{"/chan", "", "application/json", `[{"A":0,"B":0},{"A":1,"B":0},{"A":2,"B":0}]`},
+		{"/chan", "application/x-ndjson", "application/x-ndjson", "{\"A\":0,\"B\":0}\n{\"A\":1,\"B\":0}\n{\"A\":2,\"B\":0}\n"},
+	} {
+		request := httptest.NewRequest("GET", c.path, nil)
+		if c.accept != "" {
+			request.Header.Set("Accept", c.accept)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		if response.Header().Get("Content-Type") != c.contentType || response.Body.String() != c.body {
+			t.Errorf("GET %s: invalid response %s %q", c.path, response.Header().Get("Content-Type"), response.Body)
+		}
+	}
+	if !reader.closed {
+		t.Errorf("reader not closed")
+	}
+}
@@ -0,0 +1,172 @@
+package rest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSCertReloadInterval is the minimum interval in which
+// RunServerTLS checks the certificate and key files for changes.
+var TLSCertReloadInterval = time.Second
+
+// TLSConfig sets the base TLS configuration for RunServerTLS.
+// The configuration is cloned before it is used.
+// Certificates of config are only used if RunServerTLS
+// is called without certificate and key files,
+// else they are replaced by the reloaded certificate.
+func TLSConfig(config *tls.Config) ServerOption {
+	return func(c *serverConfig) {
+		c.tlsConfig = config
+	}
+}
+
+// ClientCertificates enables mutual TLS for RunServerTLS.
+// Client certificates are verified with the certificate
+// authorities of pool. If required is true, then clients
+// without a valid certificate are rejected,
+// else only given certificates are verified.
+// Handlers can read the verified certificates from a
+// *tls.ConnectionState argument.
+func ClientCertificates(pool *x509.CertPool, required bool) ServerOption {
+	return func(c *serverConfig) {
+		c.clientCAs = pool
+		c.clientCertRequired = required
+	}
+}
+
+/*
+RunServerTLS starts an HTTPS server with HTTP/2 support
+with a given address and the handlers registered at DefaultServer.
+It is stopped the same way as RunServerGraceful.
+
+The certificate and key are loaded from the PEM encoded
+certFile and keyFile. Changes of the files are picked up
+for new connections without restarting the server,
+so renewed certificates can simply be written over the old ones.
+If certFile and keyFile are empty, then the certificates
+of the TLSConfig option are used.
+
+Example:
+
+	err := rest.RunServerTLS(":443", "cert.pem", "key.pem", nil,
+		rest.ShutdownOnSignals(),
+		rest.ClientCertificates(clientCAs, true),
+	)
+*/
+func RunServerTLS(addr, certFile, keyFile string, stop <-chan struct{}, options ...ServerOption) error {
+	return DefaultServer.RunServerTLS(addr, certFile, keyFile, stop, options...)
+}
+
+// RunServerTLS starts an HTTPS server with a given address
+// that serves the handlers registered at server.
+// See the package function RunServerTLS for details.
+func (server *Server) RunServerTLS(addr, certFile, keyFile string, stop <-chan struct{}, options ...ServerOption) error {
+	config := newServerConfig(options)
+	tlsConfig, err := config.newTLSConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	listener, err := config.listen(addr)
+	if err != nil {
+		return err
+	}
+	httpServer := config.newHTTPServer(server)
+	httpServer.TLSConfig = tlsConfig
+	return server.serve(httpServer, listener, config, stop)
+}
+
+// newTLSConfig returns the TLS configuration for a server
+// with the certificate loaded from certFile and keyFile.
+func (config *serverConfig) newTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.tlsConfig != nil {
+		tlsConfig = config.tlsConfig.Clone()
+	}
+	if certFile != "" || keyFile != "" {
+		reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+		if err := reloader.load(); err != nil {
+			return nil, err
+		}
+		// Clients without SNI would get Certificates[0]
+		// instead of the certificate from GetCertificate
+		tlsConfig.Certificates = nil
+		tlsConfig.GetCertificate = reloader.getCertificate
+	} else if len(tlsConfig.Certificates) == 0 && tlsConfig.GetCertificate == nil && tlsConfig.GetConfigForClient == nil {
+		return nil, errors.New("RunServerTLS(): no certificate and key files and no certificates in TLSConfig")
+	}
+	if config.clientCAs != nil {
+		tlsConfig.ClientCAs = config.clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if config.clientCertRequired {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// certReloader loads a certificate from files
+// and reloads it when the files are modified.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mutex   sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// modified returns the latest modification time of the files.
+func (r *certReloader) modified() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) load() error {
+	modTime, err := r.modified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.checked = time.Now()
+	return nil
+}
+
+// getCertificate implements tls.Config.GetCertificate.
+// If the files can't be reloaded, the previous certificate is used.
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if time.Since(r.checked) >= TLSCertReloadInterval {
+		r.checked = time.Now()
+		modTime, err := r.modified()
+		if err == nil && !modTime.Equal(r.modTime) {
+			err = r.load()
+			if err == nil {
+				Log("Reloaded TLS certificate", r.certFile)
+			}
+		}
+		if err != nil {
+			Log("ERROR: can't reload TLS certificate:", err)
+		}
+	}
+	return r.cert, nil
+}
@@ -0,0 +1,219 @@
+package rest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate with its key generated for tests.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	tls  tls.Certificate
+}
+
+// newTestCert creates a certificate for commonName signed by parent,
+// or a self-signed CA certificate if parent is nil.
+func newTestCert(t *testing.T, commonName string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parentCert, parentKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, tls: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}}
+}
+
+// writeFiles writes the certificate and key PEM encoded to dir.
+func (c *testCert) writeFiles(t *testing.T, dir string) (certFile, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600)
+	if err == nil {
+		err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// startTLS runs server with RunServerTLS in the background
+// and waits until it accepts connections.
+func startTLS(t *testing.T, server *Server, addr, certFile, keyFile string, stop chan struct{}, options ...ServerOption) {
+	go func() {
+		if err := server.RunServerTLS(addr, certFile, keyFile, stop, options...); err != nil {
+			t.Error(err)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server did not start")
+}
+
+func tlsClient(ca *testCert, clientCert *testCert) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	config := &tls.Config{RootCAs: pool}
+	if clientCert != nil {
+		config.Certificates = []tls.Certificate{clientCert.tls}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config, ForceAttemptHTTP2: true, DisableKeepAlives: true}}
+}
+
+func TestRunServerTLS(t *testing.T) {
+	ca := newTestCert(t, "Test CA", nil)
+	certFile, keyFile := newTestCert(t, "first", ca).writeFiles(t, t.TempDir())
+
+	server := NewServer()
+	server.HandleGET("/proto", func(request *http.Request) string { return request.Proto })
+	addr := freeAddr(t)
+	stop := make(chan struct{})
+	defer close(stop)
+	startTLS(t, server, addr, certFile, keyFile, stop)
+
+	client := tlsClient(ca, nil)
+	response, err := client.Get("https://" + addr + "/proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "HTTP/2.0" || response.TLS.PeerCertificates[0].Subject.CommonName != "first" {
+		t.Errorf("expected HTTP/2.0 with certificate first, got %s %s", body, response.TLS.PeerCertificates[0].Subject.CommonName)
+	}
+
+	// Replace the certificate files and check that they are reloaded
+	defer func(interval time.Duration) { TLSCertReloadInterval = interval }(TLSCertReloadInterval)
+	TLSCertReloadInterval = 0
+	newTestCert(t, "second", ca).writeFiles(t, filepath.Dir(certFile))
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	response, err = client.Get("https://" + addr + "/proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if cn := response.TLS.PeerCertificates[0].Subject.CommonName; cn != "second" {
+		t.Errorf("expected reloaded certificate second, got %s", cn)
+	}
+}
+
+func TestRunServerTLS_configCertificatesWithoutSNI(t *testing.T) {
+	ca := newTestCert(t, "Test CA", nil)
+	certFile, keyFile := newTestCert(t, "first", ca).writeFiles(t, t.TempDir())
+
+	addr := freeAddr(t)
+	stop := make(chan struct{})
+	defer close(stop)
+	startTLS(t, NewServer(), addr, certFile, keyFile, stop,
+		TLSConfig(&tls.Config{Certificates: []tls.Certificate{newTestCert(t, "config", ca).tls}}),
+	)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	// Clients don't send SNI for IP addresses
+	peerName := func() string {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: pool})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	if cn := peerName(); cn != "first" {
+		t.Errorf("expected certificate first, got %s", cn)
+	}
+
+	defer func(interval time.Duration) { TLSCertReloadInterval = interval }(TLSCertReloadInterval)
+	TLSCertReloadInterval = 0
+	newTestCert(t, "second", ca).writeFiles(t, filepath.Dir(certFile))
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	if cn := peerName(); cn != "second" {
+		t.Errorf("expected reloaded certificate second, got %s", cn)
+	}
+}
+
+func TestRunServerTLS_clientCertificates(t *testing.T) {
+	ca := newTestCert(t, "Test CA", nil)
+	serverCert := newTestCert(t, "server", ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	server := NewServer()
+	server.HandleGET("/whoami", func(state *tls.ConnectionState) string {
+		return state.PeerCertificates[0].Subject.CommonName
+	})
+	addr := freeAddr(t)
+	stop := make(chan struct{})
+	defer close(stop)
+	startTLS(t, server, addr, "", "", stop,
+		TLSConfig(&tls.Config{Certificates: []tls.Certificate{serverCert.tls}}),
+		ClientCertificates(pool, true),
+	)
+
+	response, err := tlsClient(ca, newTestCert(t, "client", ca)).Get("https://" + addr + "/whoami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if string(body) != "client" {
+		t.Errorf("expected client, got %s", body)
+	}
+
+	if _, err := tlsClient(ca, nil).Get("https://" + addr + "/whoami"); err == nil {
+		t.Error("request without client certificate must fail")
+	}
+}
+
+func TestRunServerTLS_noCertificate(t *testing.T) {
+	if err := NewServer().RunServerTLS(freeAddr(t), "", "", nil); err == nil {
+		t.Error("expected error without certificate")
+	}
+}
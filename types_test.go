@@ -0,0 +1,38 @@
+package rest
+
+// The test types are shared by all test files,
+// so they must not be behind the goci build tag of server_test.go.
+
+type MyIntType int
+
+type Struct struct {
+	Bool      bool
+	Int       int
+	Uint      uint
+	Ignore    int `json:"-" xml:"-"`
+	Float32   float32
+	Float64   float64
+	String    string
+	SubStruct SubStruct
+}
+
+type SubStruct struct {
+	A MyIntType
+	B MyIntType
+}
+
+func NewStruct() *Struct {
+	return &Struct{
+		Bool:    true,
+		Int:     1,
+		Uint:    2,
+		Ignore:  3,
+		Float32: 4,
+		Float64: 5,
+		String:  "7",
+		SubStruct: SubStruct{
+			A: 8,
+			B: 9,
+		},
+	}
+}
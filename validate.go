@@ -0,0 +1,427 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+/*
+Validator can be implemented by handler argument types
+to validate decoded arguments beyond the rules of validate tags.
+Validate is called after the validate tags of the struct
+have been checked.
+
+If Validate returns an HTTPError and no validate tag rules
+were violated, then the HTTPError will be the response.
+Any other error will be listed as violation in the
+422 unprocessable entity response.
+Errors implementing Unwrap() []error, like the ones returned
+by errors.Join, are listed as separate violations.
+*/
+type Validator interface {
+	Validate() error
+}
+
+// validateArgsFunc returns getArgs wrapped so that all struct pointer
+// arguments are validated after decoding, see HandlePOST for the rules.
+// The validate tags of the argument types are parsed upfront,
+// so invalid tags panic at handler registration.
+func validateArgsFunc(in []reflect.Type, getArgs getArgsFunc) getArgsFunc {
+	validate := false
+	for _, t := range in {
+		if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+			structValidationFor(t.Elem())
+			validate = true
+		}
+	}
+	if !validate {
+		return getArgs
+	}
+	return func(request *http.Request) ([]reflect.Value, error) {
+		args, err := getArgs(request)
+		if err != nil {
+			return nil, err
+		}
+		mediaType, _, _ := parseContentType(request)
+		jsonNames := isJSONMediaType(mediaType)
+		for _, arg := range args {
+			if err := validateArg(arg, jsonNames); err != nil {
+				// The handler won't be called, so cleanupMultipart
+				// gets no args to close the uploaded files of
+				if request.MultipartForm != nil {
+					closeFileArgs(request.MultipartForm, args)
+				}
+				return nil, err
+			}
+		}
+		return args, nil
+	}
+}
+
+// validateArg validates the validate tags of a struct pointer arg
+// and calls its Validate method if it implements Validator.
+// Violations are returned as 422 HTTPError with the fields
+// named like JSON object keys if jsonNames is true,
+// else like form keys.
+func validateArg(arg reflect.Value, jsonNames bool) error {
+	if arg.Kind() != reflect.Ptr || arg.IsNil() || arg.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	var errs fieldErrors
+	validateStruct(arg.Elem(), "", jsonNames, &errs)
+	if validator, ok := arg.Interface().(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			var httpErr *HTTPError
+			var fieldErrs fieldErrors
+			switch {
+			case len(errs) == 0 && errors.As(err, &httpErr):
+				return httpErr
+			case errors.As(err, &fieldErrs):
+				errs = append(errs, fieldErrs...)
+			default:
+				if joined, ok := err.(interface{ Unwrap() []error }); ok {
+					for _, e := range joined.Unwrap() {
+						errs = append(errs, fieldError{Reason: e.Error()})
+					}
+				} else {
+					errs = append(errs, fieldError{Reason: err.Error()})
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return &HTTPError{Status: http.StatusUnprocessableEntity, Message: "validation failed", Details: errs}
+	}
+	return nil
+}
+
+// validateStruct appends the violated validate tag rules
+// of the fields of the struct v to errs.
+// Field names are prefixed with prefix.
+func validateStruct(v reflect.Value, prefix string, jsonNames bool, errs *fieldErrors) {
+	for _, f := range structValidationFor(v.Type()).fields {
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil {
+			continue // nil embedded pointer
+		}
+		name := prefix + f.name
+		if jsonNames {
+			name = prefix + f.jsonName
+		}
+		for _, rule := range f.rules {
+			if reason := rule(fv); reason != "" {
+				*errs = append(*errs, fieldError{Field: name, Value: validationValue(fv), Reason: reason})
+				break
+			}
+		}
+		if !f.nested {
+			continue
+		}
+		for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		switch fv.Kind() {
+		case reflect.Struct:
+			validateStruct(fv, name+".", jsonNames, errs)
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < fv.Len(); i++ {
+				elem := fv.Index(i)
+				for elem.Kind() == reflect.Ptr && !elem.IsNil() {
+					elem = elem.Elem()
+				}
+				if elem.Kind() == reflect.Struct {
+					validateStruct(elem, fmt.Sprintf("%s[%d].", name, i), jsonNames, errs)
+				}
+			}
+		}
+	}
+}
+
+// validationValue formats v for a fieldError.
+func validationValue(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map, reflect.Interface:
+		return ""
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// validationRule returns the reason why v violates the rule,
+// or an empty string if v is valid.
+type validationRule func(v reflect.Value) string
+
+type fieldValidation struct {
+	index    []int
+	name     string // form key
+	jsonName string // JSON object key
+	rules    []validationRule
+	nested   bool // struct or slice of structs
+}
+
+type structValidation struct {
+	fields []fieldValidation
+}
+
+var (
+	validationCache = make(map[reflect.Type]*structValidation)
+	validationMutex sync.RWMutex
+)
+
+// structValidationFor returns the parsed validate tags of
+// the struct type t and its nested structs.
+// It panics if a tag is invalid.
+func structValidationFor(t reflect.Type) *structValidation {
+	validationMutex.RLock()
+	sv, ok := validationCache[t]
+	validationMutex.RUnlock()
+	if ok {
+		return sv
+	}
+	validationMutex.Lock()
+	defer validationMutex.Unlock()
+	return structValidationLocked(t)
+}
+
+func structValidationLocked(t reflect.Type) *structValidation {
+	if sv, ok := validationCache[t]; ok {
+		return sv
+	}
+	sv := new(structValidation)
+	// Store before parsing the fields for recursive types
+	validationCache[t] = sv
+	fields := validatedFields(t)
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].name < fields[j].name })
+	for _, f := range fields {
+		field := t.FieldByIndex(f.index)
+		rules, err := parseValidateTag(field.Tag.Get("validate"), field.Type)
+		if err != nil {
+			delete(validationCache, t)
+			panic(fmt.Errorf("invalid validate tag of %s.%s: %w", t, field.Name, err))
+		}
+		nestedType := field.Type
+		for nestedType.Kind() == reflect.Ptr || nestedType.Kind() == reflect.Slice || nestedType.Kind() == reflect.Array {
+			nestedType = nestedType.Elem()
+		}
+		nested := nestedType.Kind() == reflect.Struct && nestedType != timeType
+		if nested {
+			structValidationLocked(nestedType)
+		}
+		if len(rules) > 0 || nested {
+			f.rules, f.nested = rules, nested
+			sv.fields = append(sv.fields, f)
+		}
+	}
+	return sv
+}
+
+// validatedFields returns the exported fields of the struct type t
+// and the promoted fields of its embedded structs with their names.
+// Unlike structFormFields, fields tagged with the name "-"
+// are included, because the tag only excludes them from decoding,
+// not from validation. They are named like the Go field,
+// and if only the JSON name is "-", then like the form key.
+func validatedFields(t reflect.Type) []fieldValidation {
+	var fields []fieldValidation
+	names := make(map[string]bool)
+	var embedded [][]int
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, tagged := formFieldName(field)
+		if field.Anonymous && !tagged {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, field.Index)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "-" {
+			name = field.Name
+		}
+		jsonName := field.Name
+		switch tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag {
+		case "":
+		case "-":
+			jsonName = name
+		default:
+			jsonName = tag
+		}
+		fields = append(fields, fieldValidation{index: field.Index, name: name, jsonName: jsonName})
+		names[name] = true
+	}
+	// Promote the fields of embedded structs
+	// if not shadowed by fields of t
+	for _, index := range embedded {
+		ft := t.FieldByIndex(index).Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft == t {
+			continue // recursive type
+		}
+		for _, f := range validatedFields(ft) {
+			if !names[f.name] {
+				f.index = append(append([]int(nil), index...), f.index...)
+				fields = append(fields, f)
+				names[f.name] = true
+			}
+		}
+	}
+	return fields
+}
+
+// parseValidateTag parses the rules of a validate tag
+// for a field of type t.
+func parseValidateTag(tag string, t reflect.Type) (rules []validationRule, err error) {
+	if tag == "" || tag == "-" {
+		return nil, nil
+	}
+	for _, r := range strings.Split(tag, ",") {
+		name, param := r, ""
+		if i := strings.IndexByte(r, '='); i >= 0 {
+			name, param = r[:i], r[i+1:]
+		}
+		var rule validationRule
+		switch name {
+		case "required":
+			rule = func(v reflect.Value) string {
+				if v.IsZero() || ((v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0) {
+					return "required"
+				}
+				return ""
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s needs a number parameter, got %q", name, param)
+			}
+			rule, err = limitRule(name, limit, param, t)
+			if err != nil {
+				return nil, err
+			}
+		case "email":
+			if elemKind(t) != reflect.String {
+				return nil, fmt.Errorf("email can only be used for strings, got %s", t)
+			}
+			rule = skipNil(func(v reflect.Value) string {
+				addr, err := mail.ParseAddress(v.String())
+				if err != nil || addr.Address != v.String() {
+					return "must be an email address"
+				}
+				return ""
+			})
+		case "oneof":
+			values := strings.Fields(param)
+			if len(values) == 0 {
+				return nil, errors.New("oneof needs space separated values")
+			}
+			rule = skipNil(func(v reflect.Value) string {
+				s := fmt.Sprint(v.Interface())
+				for _, value := range values {
+					if s == value {
+						return ""
+					}
+				}
+				return "must be one of " + param
+			})
+		default:
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// limitRule returns a min or max rule that compares
+// numbers by value and strings, slices and maps by length.
+func limitRule(name string, limit float64, param string, t reflect.Type) (validationRule, error) {
+	violated := func(x float64) bool {
+		if name == "min" {
+			return x < limit
+		}
+		return x > limit
+	}
+	bound := "at least"
+	if name == "max" {
+		bound = "at most"
+	}
+	switch elemKind(t) {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return skipNil(func(v reflect.Value) string {
+			if violated(float64(v.Int())) {
+				return "must be " + bound + " " + param
+			}
+			return ""
+		}), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return skipNil(func(v reflect.Value) string {
+			if violated(float64(v.Uint())) {
+				return "must be " + bound + " " + param
+			}
+			return ""
+		}), nil
+	case reflect.Float32, reflect.Float64:
+		return skipNil(func(v reflect.Value) string {
+			if violated(v.Float()) {
+				return "must be " + bound + " " + param
+			}
+			return ""
+		}), nil
+	case reflect.String:
+		return skipNil(func(v reflect.Value) string {
+			if violated(float64(utf8.RuneCountInString(v.String()))) {
+				return "length must be " + bound + " " + param
+			}
+			return ""
+		}), nil
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return skipNil(func(v reflect.Value) string {
+			if violated(float64(v.Len())) {
+				return "length must be " + bound + " " + param
+			}
+			return ""
+		}), nil
+	}
+	return nil, fmt.Errorf("%s can't be used for %s", name, t)
+}
+
+// elemKind returns the kind of t after dereferencing pointers.
+func elemKind(t reflect.Type) reflect.Kind {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind()
+}
+
+// skipNil returns a rule that dereferences pointers
+// and accepts nil pointers without calling rule.
+func skipNil(rule validationRule) validationRule {
+	return func(v reflect.Value) string {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return ""
+			}
+			v = v.Elem()
+		}
+		return rule(v)
+	}
+}
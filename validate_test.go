@@ -0,0 +1,119 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+type validatedItem struct {
+	Name string `json:"name" validate:"required,max=5"`
+}
+
+type validatedStruct struct {
+	Name  string          `json:"name" validate:"required,min=2,max=10"`
+	Email *string         `json:"email" validate:"email"`
+	Age   int             `json:"age" validate:"min=18,max=130"`
+	Role  string          `json:"role" validate:"oneof=admin user"`
+	Tags  []string        `json:"tags" validate:"max=2"`
+	Items []validatedItem `json:"items"`
+}
+
+func (s *validatedStruct) Validate() error {
+	if s.Role == "admin" && s.Age < 21 {
+		return errors.New("admins must be at least 21")
+	}
+	return nil
+}
+
+func TestValidation(t *testing.T) {
+	server := NewServer()
+	server.HandlePOST("/validated", func(in *validatedStruct) string { return "ok" })
+	server.HandleGET("/validated", func(in *validatedStruct) string { return "ok" })
+
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		status   int
+		expected string
+	}{
+		{"POST", "/validated", `{"name":"Erik","age":40,"role":"user"}`, http.StatusOK, "ok"},
+		{"POST", "/validated", `{"name":"Erik","email":"erik@example.com","age":40,"role":"admin","items":[{"name":"a"}]}`, http.StatusOK, "ok"},
+		{"POST", "/validated", `{"name":"E","email":"no mail","age":10,"role":"guest","tags":["a","b","c"],"items":[{"name":"toolong"},{}]}`, http.StatusUnprocessableEntity,
+			`{"status":422,"message":"validation failed","details":[` +
+				`{"field":"age","value":"10","reason":"must be at least 18"},` +
+				`{"field":"email","value":"no mail","reason":"must be an email address"},` +
+				`{"field":"items[0].name","value":"toolong","reason":"length must be at most 5"},` +
+				`{"field":"items[1].name","value":"","reason":"required"},` +
+				`{"field":"name","value":"E","reason":"length must be at least 2"},` +
+				`{"field":"role","value":"guest","reason":"must be one of admin user"},` +
+				`{"field":"tags","value":"","reason":"length must be at most 2"}]}`},
+		{"POST", "/validated", `{"name":"Erik","age":20,"role":"admin"}`, http.StatusUnprocessableEntity,
+			`{"status":422,"message":"validation failed","details":[{"field":"","value":"","reason":"admins must be at least 21"}]}`},
+		{"GET", "/validated?name=Erik&age=200&role=user", "", http.StatusUnprocessableEntity,
+			`{"status":422,"message":"validation failed","details":[{"field":"age","value":"200","reason":"must be at most 130"}]}`},
+	}
+	for _, test := range tests {
+		contentType := ""
+		if test.body != "" {
+			contentType = "application/json"
+		}
+		response := serveBody(server, test.method, test.path, contentType, test.body)
+		if response.Code != test.status || response.Body.String() != test.expected {
+			t.Errorf("%s %s %s: expected %d %s, got %d %s", test.method, test.path, test.body, test.status, test.expected, response.Code, response.Body)
+		}
+	}
+}
+
+func TestValidation_invalidTag(t *testing.T) {
+	for _, handler := range []interface{}{
+		func(in *struct {
+			A string `validate:"unknown"`
+		}) {
+		},
+		func(in *struct {
+			A bool `validate:"min=1"`
+		}) {
+		},
+		func(in *struct {
+			A int `validate:"email"`
+		}) {
+		},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("invalid validate tag of %T must panic", handler)
+				}
+			}()
+			NewServer().HandlePOST("/invalid", handler)
+		}()
+	}
+}
+
+type validatedNames struct {
+	Name   string `form:"user_name" json:"userName" validate:"required"`
+	Secret string `json:"-" validate:"required"`
+}
+
+func TestValidation_fieldNames(t *testing.T) {
+	server := NewServer()
+	server.HandlePOST("/names", func(in *validatedNames) string { return "ok" })
+
+	for _, test := range []struct {
+		contentType string
+		body        string
+		expected    string
+	}{
+		{"application/json", `{"userName":"Erik"}`, `[{"field":"Secret","value":"","reason":"required"}]`},
+		{"application/vnd.api+json", `{}`, `[{"field":"Secret","value":"","reason":"required"},{"field":"userName","value":"","reason":"required"}]`},
+		{"application/x-www-form-urlencoded", `Secret=x`, `[{"field":"Secret","value":"","reason":"required"},{"field":"user_name","value":"","reason":"required"}]`},
+	} {
+		response := serveBody(server, "POST", "/names", test.contentType, test.body)
+		expected := `{"status":422,"message":"validation failed","details":` + test.expected + `}`
+		if response.Code != http.StatusUnprocessableEntity || response.Body.String() != expected {
+			t.Errorf("%s %s: expected 422 %s, got %d %s", test.contentType, test.body, expected, response.Code, response.Body)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package rest
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var (
+	// WebSocketMaxMessageSize is the maximum size in bytes
+	// of a message received over a WebSocket connection.
+	// Connections with larger messages will be closed.
+	WebSocketMaxMessageSize int64 = 1 << 20
+
+	// WebSocketCheckOrigin returns if a WebSocket connection
+	// for request is allowed. The default allows requests
+	// without Origin header or with an Origin whose host
+	// matches the Host of the request.
+	WebSocketCheckOrigin = sameOrigin
+)
+
+/*
+HandleWebSocket registers a WebSocket endpoint for path.
+
+Every text message received from the client is unmarshalled as JSON
+into a new instance of the message argument of handler, and the
+first result value of handler will be marshalled as JSON and sent
+back as reply if it is not nil.
+An error result will be sent as message with the HTTPError
+format of HTTP error responses, the connection stays open.
+Struct pointer messages are validated like the arguments of HandlePOST.
+
+handler can take an optional context.Context as first argument
+that is cancelled when the connection is closed or the server stopped,
+and an optional send channel before the message argument.
+Values sent to that channel are marshalled as JSON and pushed to the
+client. The channel is the same for all messages of a connection
+and must not be sent to after the context has been cancelled.
+
+A single optional argument can be passed as object.
+In that case handler is interpreted as a method and
+object is the address of an object with such a method.
+
+Middleware that wraps the http.ResponseWriter must implement
+Unwrap() http.ResponseWriter so that the connection can be hijacked,
+else the upgrade fails with a 500 internal server error.
+
+Format of WebSocket handler:
+
+	func([context.Context, ][chan<- T, ]message) ([value][, error]) {}
+
+Example:
+
+	rest.HandleWebSocket("/chat", func(ctx context.Context, push chan<- *Message, in *Message) error {
+		return chatRoom.Post(ctx, in, push)
+	})
+*/
+func HandleWebSocket(path string, handler interface{}, object ...interface{}) {
+	DefaultServer.HandleWebSocket(path, handler, object...)
+}
+
+// HandleWebSocket registers a WebSocket endpoint for path at server.
+// See the package function HandleWebSocket for details.
+func (server *Server) HandleWebSocket(path string, handler interface{}, object ...interface{}) {
+	server.handleWebSocket(path, handler, object, nil)
+}
+
+func (server *Server) handleWebSocket(path string, handler interface{}, object []interface{}, middleware []func(http.Handler) http.Handler) {
+	handlerFunc, in, out := getHandlerFunc(handler, object)
+	info := &RouteInfo{Method: "GET", Path: path, Handler: handler, Args: in, Results: out, protocol: "websocket"}
+	wsHandler := &webSocketHandler{handlerFunc: handlerFunc}
+	if len(in) > 0 && in[0].Kind() == reflect.Chan {
+		if in[0].ChanDir()&reflect.SendDir == 0 || !isEncodable(in[0].Elem()) {
+			panic(fmt.Errorf("HandleWebSocket(): push channel argument must be sendable with elements marshallable as JSON, got %s", in[0]))
+		}
+		wsHandler.pushType = in[0]
+		in = in[1:]
+	}
+	if len(in) != 1 {
+		panic(fmt.Errorf("HandleWebSocket(): handler must have exactly one message argument, got %d", len(in)))
+	}
+	wsHandler.messageType = in[0]
+	if in[0].Kind() == reflect.Ptr && in[0].Elem().Kind() == reflect.Struct {
+		structValidationFor(in[0].Elem()) // panics for invalid validate tags
+	}
+	switch len(out) {
+	case 0:
+	case 1:
+		if out[0] != errorType && !isEncodable(out[0]) {
+			panic(fmt.Errorf("HandleWebSocket(): result value of handler must be marshallable as JSON, got %s", out[0]))
+		}
+	case 2:
+		if !isEncodable(out[0]) || out[1] != errorType {
+			panic(fmt.Errorf("HandleWebSocket(): result values of handler must be a value marshallable as JSON and an error, got %s, %s", out[0], out[1]))
+		}
+	default:
+		panic(fmt.Errorf("HandleWebSocket(): zero to two return values allowed, got %d", len(out)))
+	}
+	server.add(info, parsePathTemplate(path), wsHandler, middleware)
+}
+
+type webSocketHandler struct {
+	handlerFunc reflectionFunc
+	pushType    reflect.Type
+	messageType reflect.Type
+}
+
+func (handler *webSocketHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	defer recoverPanic(writer, request)
+
+	conn, err := upgradeWebSocket(writer, request)
+	if err != nil {
+		writeError(writer, err)
+		return
+	}
+	defer conn.netConn.Close()
+
+	ctx, cancel := context.WithCancel(request.Context())
+	defer cancel()
+	shutdown := shutdownChan(request)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-shutdown:
+			conn.writeClose(wsCloseGoingAway, "server stopped")
+			cancel()
+			conn.netConn.Close()
+		}
+	}()
+
+	request = request.WithContext(ctx)
+	var fixedArgs []reflect.Value
+	if handler.pushType != nil {
+		push := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, handler.pushType.Elem()), 0)
+		fixedArgs = append(fixedArgs, push.Convert(handler.pushType))
+		go conn.writePushed(ctx, push)
+	}
+
+	for {
+		opcode, message, err := conn.readMessage()
+		if err != nil {
+			var closeErr *wsCloseError
+			if errors.As(err, &closeErr) {
+				conn.writeClose(closeErr.code, closeErr.reason)
+			} else if err != io.EOF && ctx.Err() == nil {
+				Log("ERROR:", err)
+			}
+			return
+		}
+		if opcode != wsOpText {
+			conn.writeClose(wsCloseUnsupportedData, "only text messages are supported")
+			return
+		}
+		if !handler.handleMessage(conn, writer, request, fixedArgs, message) {
+			return
+		}
+	}
+}
+
+// handleMessage calls the handler with message
+// and writes the result to conn.
+// It returns false if the connection has to be closed.
+func (handler *webSocketHandler) handleMessage(conn *wsConn, writer http.ResponseWriter, request *http.Request, fixedArgs []reflect.Value, message []byte) (ok bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			stack := debug.Stack()
+			Log("PANIC:", request.Method, request.URL, recovered, "\n"+string(stack))
+			if OnPanic != nil {
+				OnPanic(request, recovered, stack)
+			}
+			conn.writeClose(wsCloseInternalError, "panic in handler")
+			ok = false
+		}
+	}()
+
+	arg := reflect.New(handler.messageType)
+	if err := json.Unmarshal(message, arg.Interface()); err != nil {
+		return conn.writeJSON(decodeError(err, message)) == nil
+	}
+	if err := validateArg(arg.Elem(), true); err != nil {
+		return conn.writeJSON(err) == nil
+	}
+	args := append(append([]reflect.Value(nil), fixedArgs...), arg.Elem())
+	result := handler.handlerFunc(writer, request, args)
+	if len(result) > 0 && result[len(result)-1].Type() == errorType && !result[len(result)-1].IsNil() {
+		err := result[len(result)-1].Interface().(error)
+		Log("ERROR:", err)
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) {
+			httpErr = &HTTPError{Status: http.StatusInternalServerError, Message: err.Error()}
+		}
+		return conn.writeJSON(httpErr) == nil
+	}
+	if len(result) > 0 && result[0].Type() != errorType && !isNil(result[0]) {
+		return conn.writeJSON(result[0].Interface()) == nil
+	}
+	return true
+}
+
+// sameOrigin returns true if request has no Origin header
+// or the host of the Origin matches the Host of the request.
+func sameOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, request.Host)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// Minimal RFC 6455 implementation:
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	wsCloseNormal          = 1000
+	wsCloseGoingAway       = 1001
+	wsCloseProtocolError   = 1002
+	wsCloseUnsupportedData = 1003
+	wsCloseInvalidPayload  = 1007
+	wsCloseTooBig          = 1009
+	wsCloseInternalError   = 1011
+
+	wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// wsCloseError is returned by readMessage if the
+// connection has to be closed with code.
+type wsCloseError struct {
+	code   int
+	reason string
+}
+
+func (e *wsCloseError) Error() string {
+	return fmt.Sprintf("websocket closed with %d %s", e.code, e.reason)
+}
+
+type wsConn struct {
+	netConn    net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+	closeSent  bool
+}
+
+// headerContainsToken returns if the comma separated
+// header values of name contain token case-insensitive.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebSocket checks the opening handshake of request,
+// hijacks the connection and sends the handshake response.
+func upgradeWebSocket(writer http.ResponseWriter, request *http.Request) (*wsConn, error) {
+	if !headerContainsToken(request.Header, "Connection", "upgrade") || !headerContainsToken(request.Header, "Upgrade", "websocket") {
+		return nil, BadRequest("expected WebSocket upgrade request")
+	}
+	if request.Header.Get("Sec-WebSocket-Version") != "13" {
+		writer.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, NewHTTPError(http.StatusUpgradeRequired, "unsupported WebSocket version")
+	}
+	key := request.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, BadRequest("invalid Sec-WebSocket-Key")
+	}
+	if !WebSocketCheckOrigin(request) {
+		return nil, Forbidden("WebSocket origin not allowed")
+	}
+	// ResponseController finds the Hijacker behind
+	// middleware writers that implement Unwrap
+	netConn, buf, err := http.NewResponseController(writer).Hijack()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil, fmt.Errorf("WebSocket not supported by %T", writer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	hash := sha1.Sum([]byte(key + wsAcceptGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n"
+	if _, err := netConn.Write([]byte(response)); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return &wsConn{netConn: netConn, reader: buf.Reader}, nil
+}
+
+// readFrame reads a single frame from the client
+// and returns its FIN bit, opcode and unmasked payload.
+func (conn *wsConn) readFrame(maxSize int64) (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(conn.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &wsCloseError{wsCloseProtocolError, "reserved bits set"}
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, &wsCloseError{wsCloseProtocolError, "client frames must be masked"}
+	}
+	length := int64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(conn.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(conn.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+	if opcode >= wsOpClose && (length > 125 || !fin) {
+		return false, 0, nil, &wsCloseError{wsCloseProtocolError, "invalid control frame"}
+	}
+	if length < 0 || length > maxSize {
+		return false, 0, nil, &wsCloseError{wsCloseTooBig, "message too big"}
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(conn.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(conn.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// validWSCloseCode returns if code may be received in a close frame.
+// Codes like 1005 and 1006 are reserved for reporting locally
+// and must not be sent, see RFC 6455 section 7.4.
+func validWSCloseCode(code uint16) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true // registered and private use codes
+	}
+	return false
+}
+
+// readMessage reads the next complete data message,
+// answering pings and close frames on the way.
+// A close frame from the client results in io.EOF.
+func (conn *wsConn) readMessage() (opcode byte, message []byte, err error) {
+	for {
+		fin, op, payload, err := conn.readFrame(WebSocketMaxMessageSize - int64(len(message)))
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case wsOpPing:
+			if err := conn.writeFrame(wsOpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			code := wsCloseNormal
+			if len(payload) == 1 || (len(payload) >= 2 && !validWSCloseCode(binary.BigEndian.Uint16(payload))) {
+				code = wsCloseProtocolError
+			}
+			conn.writeClose(code, "")
+			return 0, nil, io.EOF
+		case wsOpText, wsOpBinary:
+			if message != nil {
+				return 0, nil, &wsCloseError{wsCloseProtocolError, "expected continuation frame"}
+			}
+			opcode = op
+			message = payload
+		case wsOpContinuation:
+			if message == nil {
+				return 0, nil, &wsCloseError{wsCloseProtocolError, "unexpected continuation frame"}
+			}
+			message = append(message, payload...)
+		default:
+			return 0, nil, &wsCloseError{wsCloseProtocolError, "unknown opcode"}
+		}
+		if fin {
+			if opcode == wsOpText && !utf8.Valid(message) {
+				return 0, nil, &wsCloseError{wsCloseInvalidPayload, "invalid UTF-8"}
+			}
+			return opcode, message, nil
+		}
+	}
+}
+
+// writeFrame writes a single unmasked frame with FIN bit set.
+func (conn *wsConn) writeFrame(opcode byte, payload []byte) error {
+	conn.writeMutex.Lock()
+	defer conn.writeMutex.Unlock()
+	if conn.closeSent {
+		return net.ErrClosed
+	}
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+	switch length := len(payload); {
+	case length <= 125:
+		header[1] = byte(length)
+	case length <= 0xFFFF:
+		header[1] = 126
+		header = header[:4]
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header[1] = 127
+		header = header[:10]
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	if opcode == wsOpClose {
+		conn.closeSent = true
+	}
+	_, err := conn.netConn.Write(append(header, payload...))
+	return err
+}
+
+// writeClose writes a close frame if none has been written before.
+func (conn *wsConn) writeClose(code int, reason string) {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	conn.writeFrame(wsOpClose, append(payload, reason...))
+}
+
+// writeJSON writes v marshalled as JSON in a text frame.
+func (conn *wsConn) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return conn.writeFrame(wsOpText, data)
+}
+
+// writePushed writes all values received from push
+// until ctx is done.
+func (conn *wsConn) writePushed(ctx context.Context, push reflect.Value) {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: push},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+	for {
+		chosen, value, ok := reflect.Select(cases)
+		if chosen == 1 || !ok {
+			return
+		}
+		if err := conn.writeJSON(value.Interface()); err != nil {
+			Log("ERROR:", err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package rest
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialWebSocket performs the opening handshake with server at path
+// and returns the connection and a reader for the frames.
+func dialWebSocket(t *testing.T, server *httptest.Server, path string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	request := "GET " + path + " HTTP/1.1\r\n" +
+		"Host: " + server.Listener.Addr().String() + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(request)); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Example from RFC 6455 section 1.3
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("invalid handshake response %s %v", response.Status, response.Header)
+	}
+	return conn, reader
+}
+
+// writeClientFrame writes a masked frame like a client.
+func writeClientFrame(t *testing.T, conn net.Conn, opcode byte, payload string) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i := range payload {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readServerFrame reads an unmasked frame with up to 125 bytes payload.
+func readServerFrame(t *testing.T, reader *bufio.Reader) (opcode byte, payload string) {
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, header[1]&0x7F)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0F, string(data)
+}
+
+func TestHandleWebSocket(t *testing.T) {
+	server := NewServer()
+	server.HandleWebSocket("/ws", func(ctx context.Context, push chan<- string, in *SubStruct) (*SubStruct, error) {
+		if in.A < 0 {
+			return nil, BadRequest("negative")
+		}
+		if in.A == 0 {
+			go func() {
+				select {
+				case push <- "pushed":
+				case <-ctx.Done():
+				}
+			}()
+			return nil, nil
+		}
+		return &SubStruct{A: in.A * 2, B: in.B}, nil
+	})
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	conn, reader := dialWebSocket(t, httpServer, "/ws")
+	defer conn.Close()
+
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{`{"A":21,"B":1}`, `{"A":42,"B":1}`},
+		{`{"A":-1}`, `{"status":400,"message":"negative"}`},
+		{`{"A":"x"}`, `{"status":400,"message":"invalid JSON","details":[{"field":"A","value":"x","reason":"expected rest.MyIntType"}]}`},
+		{`{"A":0}`, `"pushed"`},
+	}
+	for _, test := range tests {
+		writeClientFrame(t, conn, wsOpText, test.message)
+		opcode, payload := readServerFrame(t, reader)
+		if opcode != wsOpText || payload != test.expected {
+			t.Errorf("message %s: expected %s, got %d %s", test.message, test.expected, opcode, payload)
+		}
+	}
+
+	writeClientFrame(t, conn, wsOpPing, "hello")
+	if opcode, payload := readServerFrame(t, reader); opcode != wsOpPong || payload != "hello" {
+		t.Errorf("expected pong, got %d %q", opcode, payload)
+	}
+
+	writeClientFrame(t, conn, wsOpClose, "\x03\xe8")
+	if opcode, payload := readServerFrame(t, reader); opcode != wsOpClose || binary.BigEndian.Uint16([]byte(payload)) != wsCloseNormal {
+		t.Errorf("expected close, got %d %q", opcode, payload)
+	}
+}
+
+func TestHandleWebSocket_closeCodes(t *testing.T) {
+	server := NewServer()
+	server.HandleWebSocket("/ws", func(in *SubStruct) *SubStruct { return in })
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	for payload, expected := range map[string]uint16{
+		"":                     wsCloseNormal,
+		"\x03\xe9":             wsCloseNormal, // 1001 going away
+		"\x0f\xa0" + "private": wsCloseNormal, // 4000
+		"\x03":                 wsCloseProtocolError,
+		"\x03\xed":             wsCloseProtocolError, // 1005 no status
+		"\x03\xee":             wsCloseProtocolError, // 1006 abnormal closure
+		"\x03\xf7":             wsCloseProtocolError, // 1015 TLS handshake
+		"\x13\x88":             wsCloseProtocolError, // 5000 out of range
+	} {
+		conn, reader := dialWebSocket(t, httpServer, "/ws")
+		writeClientFrame(t, conn, wsOpClose, payload)
+		opcode, reply := readServerFrame(t, reader)
+		if opcode != wsOpClose || len(reply) < 2 || binary.BigEndian.Uint16([]byte(reply)) != expected {
+			t.Errorf("close frame %q: expected close code %d, got %d %q", payload, expected, opcode, reply)
+		}
+		conn.Close()
+	}
+}
+
+func TestHandleWebSocket_wrappedWriter(t *testing.T) {
+	server := NewServer()
+	server.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			next.ServeHTTP(&unwrappingWriter{writer}, request)
+		})
+	})
+	server.HandleWebSocket("/ws", func(in string) string { return in })
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	conn, reader := dialWebSocket(t, httpServer, "/ws")
+	defer conn.Close()
+	writeClientFrame(t, conn, wsOpText, `"echo"`)
+	if opcode, payload := readServerFrame(t, reader); opcode != wsOpText || payload != `"echo"` {
+		t.Errorf("expected echo, got %d %q", opcode, payload)
+	}
+}
+
+func TestHandleWebSocket_shutdown(t *testing.T) {
+	server := NewServer()
+	server.HandleWebSocket("/ws", func(in string) {})
+	shutdown := make(chan struct{})
+	httpServer := httptest.NewUnstartedServer(server)
+	httpServer.Config.BaseContext = func(net.Listener) context.Context {
+		return context.WithValue(context.Background(), shutdownKey{}, (<-chan struct{})(shutdown))
+	}
+	httpServer.Start()
+	defer httpServer.Close()
+
+	conn, reader := dialWebSocket(t, httpServer, "/ws")
+	defer conn.Close()
+	close(shutdown)
+	if opcode, payload := readServerFrame(t, reader); opcode != wsOpClose || binary.BigEndian.Uint16([]byte(payload)) != wsCloseGoingAway {
+		t.Errorf("expected close, got %d %q", opcode, payload)
+	}
+}
+
+func TestHandleWebSocket_badRequest(t *testing.T) {
+	server := NewServer()
+	server.HandleWebSocket("/ws", func(in string) {})
+	response := serveBody(server, "GET", "/ws", "", "")
+	if response.Code != http.StatusBadRequest || !strings.Contains(response.Body.String(), "upgrade") {
+		t.Errorf("expected 400, got %d %s", response.Code, response.Body)
+	}
+
+	request := httptest.NewRequest("GET", "/ws", nil)
+	request.Header.Set("Connection", "keep-alive, Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	request.Header.Set("Origin", "http://evil.example.com")
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for foreign origin, got %d", recorder.Code)
+	}
+}